@@ -4,6 +4,7 @@ import (
 	//"container/list"
 	"github.com/vova616/chipmunk/vect"
 	//"log"
+	"sort"
 	"time"
 )
 
@@ -22,12 +23,23 @@ type BBTree struct {
 	SpatialIndex *SpatialIndex
 
 	leaves HashSet
-	root   *Node
+	// The leaves in the order they were inserted, iterated instead of the leaves map to keep stepping deterministic.
+	leafOrder []*Node
+	root      *Node
 
 	pairBuffer []*Pair
 	nodeBuffer []*Node
 
 	stamp time.Duration
+
+	// Fraction of their size the bounding boxes of the leaves are expanded by on each side.
+	Margin vect.Float
+	// Fraction of the velocity the bounding boxes of the leaves are expanded by in the direction of motion.
+	// Larger values cause fewer reinserts for fast objects but more pairs to check.
+	VelocityCoef vect.Float
+
+	// Number of leaves reinserted and of pairs found by the last ReindexQuery.
+	reinserts, pairs int
 }
 
 type Children struct {
@@ -37,6 +49,8 @@ type Children struct {
 type Leaf struct {
 	stamp time.Duration
 	pairs *Pair
+	// Index in BBTree.leafOrder.
+	index int
 }
 
 type node struct {
@@ -86,6 +100,8 @@ type Pair struct {
 func NewBBTree(staticIndex *SpatialIndex) *SpatialIndex {
 	tree := &BBTree{}
 	tree.leaves = make(map[HashValue]*Node)
+	tree.Margin = 0.1
+	tree.VelocityCoef = 0.1
 
 	tree.SpatialIndex = NewSpartialIndex(tree, staticIndex)
 	tree.pairBuffer = make([]*Pair, 0)
@@ -93,10 +109,22 @@ func NewBBTree(staticIndex *SpatialIndex) *SpatialIndex {
 	return tree.SpatialIndex
 }
 
+func (tree *BBTree) Destroy() {
+	tree.leaves = nil
+	tree.leafOrder = nil
+	tree.root = nil
+	tree.pairBuffer = nil
+	tree.nodeBuffer = nil
+}
+
 func (tree *BBTree) Count() int {
 	return len(tree.leaves)
 }
 
+func (tree *BBTree) Contains(obj Indexable) bool {
+	return tree.leaves[obj.Hash()] != nil
+}
+
 func (tree *BBTree) NewLeaf(obj Indexable) *Node {
 	node := tree.NodeFromPool()
 	node.obj = obj
@@ -119,17 +147,16 @@ func (tree *BBTree) GetBB(obj Indexable) AABB {
 	v, ok := obj.Velocity()
 	if ok {
 		bb := obj.AABB()
-		coef := vect.Float(0.1)
 
 		l := bb.Lower.X
 		b := bb.Lower.Y
 		r := bb.Upper.X
 		t := bb.Upper.Y
 
-		x := (r - l) * coef
-		y := (t - b) * coef
+		x := (r - l) * tree.Margin
+		y := (t - b) * tree.Margin
 
-		v = vect.Mult(v, 0.1)
+		v = vect.Mult(v, tree.VelocityCoef)
 
 		return NewAABB(l+vect.FMin(-x, v.X), b+vect.FMin(-y, v.Y), r+vect.FMax(x, v.X), t+vect.FMax(y, v.Y))
 	}
@@ -231,6 +258,8 @@ func (tree *BBTree) Insert(obj Indexable) {
 	leaf := tree.NewLeaf(obj)
 
 	tree.leaves[obj.Hash()] = leaf
+	leaf.index = len(tree.leafOrder)
+	tree.leafOrder = append(tree.leafOrder, leaf)
 
 	root := tree.root
 	tree.root = tree.SubtreeInsert(root, leaf)
@@ -339,6 +368,12 @@ func (tree *BBTree) Remove(obj Indexable) {
 		return
 	}
 
+	last := len(tree.leafOrder) - 1
+	moved := tree.leafOrder[last]
+	tree.leafOrder[leaf.index], moved.index = moved, leaf.index
+	tree.leafOrder[last] = nil
+	tree.leafOrder = tree.leafOrder[:last]
+
 	tree.root = tree.SubtreeRemove(tree.root, leaf)
 	tree.PairsClear(leaf)
 	tree.NodeRecycle(leaf)
@@ -422,7 +457,9 @@ func LeafUpdate(leaf *Node, tree *BBTree) bool {
 }
 
 func (tree *BBTree) Each(fnc HashSetIterator) {
-	tree.leaves.Each(fnc)
+	for _, leaf := range tree.leafOrder {
+		fnc(leaf)
+	}
 }
 
 func (tree *BBTree) ReindexQuery(fnc SpatialIndexQueryFunc) {
@@ -430,26 +467,72 @@ func (tree *BBTree) ReindexQuery(fnc SpatialIndexQueryFunc) {
 		return
 	}
 
+	tree.reinserts = 0
+	tree.pairs = 0
+
 	// LeafUpdate() may modify tree->root. Don't cache it.
-	for _, node := range tree.leaves {
-		LeafUpdate(node, tree)
+	for _, node := range tree.leafOrder {
+		if LeafUpdate(node, tree) {
+			tree.reinserts++
+		}
 	}
 
-	staticIndex := GetTree(tree.SpatialIndex.staticIndex)
-	var staticRoot *Node = nil
-	if staticIndex != nil {
-		staticRoot = staticIndex.root
+	countFnc := fnc
+	fnc = func(a, b Indexable) {
+		tree.pairs++
+		countFnc(a, b)
 	}
 
+	staticIndex := tree.SpatialIndex.staticIndex
+	staticRoot := GetRootIfTree(staticIndex)
+
 	context := MarkContext{tree, staticRoot, fnc}
 	context.MarkSubtree(tree.root)
 	if staticIndex != nil && staticRoot == nil {
-		SpatialIndexCollideStatic(tree.SpatialIndex, staticIndex.SpatialIndex, fnc)
+		SpatialIndexCollideStatic(tree, staticIndex, fnc)
+	}
+
+	tree.IncrementStamp()
+}
+
+// Updates the bounding boxes of all the leaves.
+func (tree *BBTree) Reindex() {
+	if tree.SpatialIndex.dynamicIndex == nil {
+		tree.ReindexQuery(VoidQueryFunc)
+		return
 	}
 
+	// The leaves of a static tree only pair with the leaves of the dynamic index,
+	// reinserted leaves must find their pairs now as the dynamic leaves only check their cached pairs.
+	for _, leaf := range tree.leafOrder {
+		if LeafUpdate(leaf, tree) {
+			tree.LeafAddPairs(leaf)
+		}
+	}
 	tree.IncrementStamp()
 }
 
+// Updates the bounding box of a single object.
+func (tree *BBTree) ReindexObject(obj Indexable) {
+	leaf := tree.leaves[obj.Hash()]
+	if leaf != nil {
+		if LeafUpdate(leaf, tree) {
+			tree.LeafAddPairs(leaf)
+		}
+		tree.IncrementStamp()
+	}
+}
+
+// Returns the number of leaves reinserted by the last ReindexQuery because they moved out of their bounding box.
+func (tree *BBTree) Reinserts() int {
+	return tree.reinserts
+}
+
+// Returns the number of pairs of overlapping leaves found by the last ReindexQuery.
+func (tree *BBTree) Pairs() int {
+	return tree.pairs
+}
+
 func (tree *BBTree) Query(obj Indexable, aabb AABB, fnc SpatialIndexQueryFunc) {
 	if tree.root != nil {
 		SubtreeQuery(tree.root, obj, aabb, fnc)
@@ -467,6 +550,40 @@ func SubtreeQuery(subtree *Node, obj Indexable, bb AABB, fnc SpatialIndexQueryFu
 	}
 }
 
+func (tree *BBTree) SegmentQuery(obj Indexable, a, b vect.Vect, t_exit vect.Float, fnc SpatialIndexSegmentQueryFunc) {
+	if tree.root != nil {
+		SubtreeSegmentQuery(tree.root, obj, a, b, t_exit, fnc)
+	}
+}
+
+// Visits the children closest to a first and skips every subtree entered after t_exit.
+func SubtreeSegmentQuery(subtree *Node, obj Indexable, a, b vect.Vect, t_exit vect.Float, fnc SpatialIndexSegmentQueryFunc) vect.Float {
+	if subtree.IsLeaf() {
+		return fnc(obj, subtree.obj)
+	}
+
+	t_a := subtree.A.bb.SegmentQuery(a, b)
+	t_b := subtree.B.bb.SegmentQuery(a, b)
+
+	if t_a < t_b {
+		if t_a < t_exit {
+			t_exit = vect.FMin(t_exit, SubtreeSegmentQuery(subtree.A, obj, a, b, t_exit, fnc))
+		}
+		if t_b < t_exit {
+			t_exit = vect.FMin(t_exit, SubtreeSegmentQuery(subtree.B, obj, a, b, t_exit, fnc))
+		}
+	} else {
+		if t_b < t_exit {
+			t_exit = vect.FMin(t_exit, SubtreeSegmentQuery(subtree.B, obj, a, b, t_exit, fnc))
+		}
+		if t_a < t_exit {
+			t_exit = vect.FMin(t_exit, SubtreeSegmentQuery(subtree.A, obj, a, b, t_exit, fnc))
+		}
+	}
+
+	return t_exit
+}
+
 type MarkContext struct {
 	tree       *BBTree
 	staticRoot *Node
@@ -531,3 +648,100 @@ func (context *MarkContext) MarkLeaf(leaf *Node) {
 		//fmt.Println(i)
 	}
 }
+
+// Rebuilds the tree top-down based on cpBBTreeOptimize.
+// Trees built by inserting the objects one at a time can end up badly balanced, which slows down every query.
+// Best used on the static shapes after building a level.
+func (tree *BBTree) Optimize() {
+	root := tree.root
+	if root == nil {
+		return
+	}
+
+	nodes := make([]*Node, len(tree.leafOrder))
+	copy(nodes, tree.leafOrder)
+
+	tree.SubtreeRecycle(root)
+	tree.root = tree.partitionNodes(nodes)
+	tree.root.parent = nil
+}
+
+// Recycles the inner nodes of the subtree, the leaves are kept.
+func (tree *BBTree) SubtreeRecycle(node *Node) {
+	if !node.IsLeaf() {
+		tree.SubtreeRecycle(node.A)
+		tree.SubtreeRecycle(node.B)
+		tree.NodeRecycle(node)
+	}
+}
+
+// Splits the nodes at the median of their bounds along the longest axis of their bounding box
+// and builds a subtree for each side, the nodes go to the side whose bounding box grows the least.
+func (tree *BBTree) partitionNodes(nodes []*Node) *Node {
+	count := len(nodes)
+	if count == 1 {
+		return nodes[0]
+	} else if count == 2 {
+		return tree.NodeNew(nodes[0], nodes[1])
+	}
+
+	// Find the AABB for these nodes
+	bb := nodes[0].bb
+	for _, node := range nodes[1:] {
+		bb = CombinePtr(&bb, &node.bb)
+	}
+
+	// Split it on it's longest axis
+	splitWidth := bb.Upper.X-bb.Lower.X > bb.Upper.Y-bb.Lower.Y
+
+	// Sort the bounds and use the median as the splitting point
+	bounds := make(floatSlice, count*2)
+	for i, node := range nodes {
+		if splitWidth {
+			bounds[2*i], bounds[2*i+1] = node.bb.Lower.X, node.bb.Upper.X
+		} else {
+			bounds[2*i], bounds[2*i+1] = node.bb.Lower.Y, node.bb.Upper.Y
+		}
+	}
+	sort.Sort(bounds)
+	split := (bounds[count-1] + bounds[count]) * 0.5
+
+	// Generate the child BBs
+	a, b := bb, bb
+	if splitWidth {
+		a.Upper.X, b.Lower.X = split, split
+	} else {
+		a.Upper.Y, b.Lower.Y = split, split
+	}
+
+	// Partition the nodes
+	right := count
+	for left := 0; left < right; {
+		node := nodes[left]
+		if MergedAreaPtr(&node.bb, &b) < MergedAreaPtr(&node.bb, &a) {
+			right--
+			nodes[left], nodes[right] = nodes[right], node
+		} else {
+			left++
+		}
+	}
+
+	// All the nodes ended up on the same side, fall back to inserting them one at a time.
+	if right == count || right == 0 {
+		var subtree *Node
+		for _, node := range nodes {
+			node.parent = nil
+			subtree = tree.SubtreeInsert(subtree, node)
+		}
+		return subtree
+	}
+
+	// Recurse and build the node!
+	return tree.NodeNew(tree.partitionNodes(nodes[:right]), tree.partitionNodes(nodes[right:]))
+}
+
+type floatSlice []vect.Float
+
+func (s floatSlice) Len() int           { return len(s) }
+func (s floatSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s floatSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
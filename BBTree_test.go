@@ -0,0 +1,161 @@
+package chipmunk
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+func treeDepth(node *Node) int {
+	if node == nil || node.IsLeaf() {
+		return 0
+	}
+	a, b := treeDepth(node.A), treeDepth(node.B)
+	if a > b {
+		return a + 1
+	}
+	return b + 1
+}
+
+// Returns the hashes of the objects found by the queries in the order they were found.
+func queryOrder(index *SpatialIndex) []HashValue {
+	var order []HashValue
+	index.Query(nil, NewAABB(-100, -100, 100, 100), func(_, obj Indexable) {
+		order = append(order, obj.Hash())
+	})
+	index.SegmentQuery(nil, vect.Vect{-200, -150}, vect.Vect{200, 170}, 1, func(_, obj Indexable) vect.Float {
+		order = append(order, obj.Hash())
+		return 1
+	})
+	return order
+}
+
+func TestBBTreeOptimize(t *testing.T) {
+	static, active := indexTestShapes()
+	// A level made of many static shapes added from left to right.
+	for i := 0; i < 300; i++ {
+		x, y := vect.Float(i%30)*13-195, vect.Float(i/30)*37-180
+		body := NewBodyStatic()
+		shape := NewBox(vect.Vect{x, y}, 6, 6)
+		body.AddShape(shape)
+		shape.Update()
+		static = append(static, shape)
+	}
+
+	staticIndex, activeIndex := newTestIndexes(useBBTree, static, active)
+	otherStatic, _ := newTestIndexes(useBBTree, static, nil)
+	tree, otherTree := GetTree(staticIndex.SpatialIndexClass), GetTree(otherStatic.SpatialIndexClass)
+
+	var leaves []*Node
+	tree.Each(func(node *Node) {
+		leaves = append(leaves, node)
+	})
+
+	tree.Optimize()
+	otherTree.Optimize()
+
+	maxDepth := int(2*math.Log2(float64(len(static)))) + 1
+	if depth := treeDepth(tree.root); depth > maxDepth {
+		t.Errorf("optimized tree of %d leaves has a depth of %d, want at most %d", len(static), depth, maxDepth)
+	}
+
+	i := 0
+	tree.Each(func(node *Node) {
+		if i >= len(leaves) || node != leaves[i] {
+			t.Fatalf("leaf %d changed order", i)
+		}
+		i++
+	})
+	if i != len(leaves) {
+		t.Fatalf("%d leaves after optimizing, want %d", i, len(leaves))
+	}
+
+	// Trees built the same way find the objects in the same order.
+	order, otherOrder := queryOrder(staticIndex), queryOrder(otherStatic)
+	if len(order) != len(otherOrder) {
+		t.Fatalf("optimized trees found %d and %d objects", len(order), len(otherOrder))
+	}
+	for i := range order {
+		if order[i] != otherOrder[i] {
+			t.Fatalf("optimized trees found the objects in a different order")
+		}
+	}
+
+	all := append(append([]*Shape(nil), static...), active...)
+	check := func(stage string) {
+		compareHashSets(t, stage+" pairs", indexPairs(activeIndex), bruteForcePairs(static, active))
+		for _, bb := range []AABB{NewAABB(-50, -50, 50, 50), NewAABB(-210, 100, 210, 110)} {
+			want := bruteForceQuery(all, func(other AABB) bool { return TestOverlap(other, bb) })
+			compareHashSets(t, stage+" Query", indexQuery(staticIndex, activeIndex, bb), want)
+		}
+		a, b := vect.Vect{-200, -190}, vect.Vect{190, 200}
+		want := bruteForceQuery(all, func(bb AABB) bool { return bb.SegmentQuery(a, b) <= 1 })
+		compareHashSets(t, stage+" SegmentQuery", indexSegmentQuery(staticIndex, activeIndex, a, b), want)
+	}
+	check("optimized")
+
+	// Move the static shapes onto the active ones, one with ReindexObject and the others with Reindex.
+	moveStatic := func(shapes []*Shape) {
+		for i, shape := range shapes {
+			target := active[i%len(active)].BB.Center()
+			shape.Body.p = vect.Add(shape.Body.p, vect.Mult(vect.Sub(target, shape.BB.Center()), 0.5))
+			shape.Update()
+		}
+	}
+	moveStatic(static[:1])
+	staticIndex.ReindexObject(static[0])
+	check("reindexed object")
+
+	moveStatic(static[1:])
+	staticIndex.Reindex()
+	check("reindexed")
+
+	tree.Optimize()
+	check("optimized again")
+}
+
+// Moves the active shapes slowly for a second, returns the number of reinserts of the BBTree.
+func countReinserts(t *testing.T, margin, velocityCoef vect.Float) int {
+	_, active := indexTestShapes()
+	for _, shape := range active {
+		shape.Body.v = vect.Mult(shape.Body.v, 0.1)
+	}
+	_, activeIndex := newTestIndexes(func(space *Space) {
+		space.SetBBTreeExpansion(margin, velocityCoef)
+	}, nil, active)
+	tree := GetTree(activeIndex.SpatialIndexClass)
+
+	reinserts := 0
+	for step := 0; step < 60; step++ {
+		for _, shape := range active {
+			shape.Body.p = vect.Add(shape.Body.p, vect.Mult(shape.Body.v, 1.0/60))
+			shape.Update()
+		}
+
+		calls := 0
+		activeIndex.ReindexQuery(func(a, b Indexable) {
+			calls++
+		})
+		if tree.Pairs() != calls {
+			t.Fatalf("Pairs is %d, the callback was called %d times", tree.Pairs(), calls)
+		}
+		reinserts += tree.Reinserts()
+	}
+	return reinserts
+}
+
+func TestBBTreeExpansion(t *testing.T) {
+	none := countReinserts(t, 0, 0)
+	margin := countReinserts(t, 0.5, 0)
+	velocity := countReinserts(t, 0, 0.5)
+	if none < 60*100 {
+		t.Errorf("%d reinserts without expansion, the shapes should be reinserted every step", none)
+	}
+	if margin >= none/4 {
+		t.Errorf("%d reinserts with a margin, %d without", margin, none)
+	}
+	if velocity >= none/4 {
+		t.Errorf("%d reinserts with a velocity expansion, %d without", velocity, none)
+	}
+}
@@ -25,6 +25,11 @@ func NewAABB(l, b, r, t vect.Float) AABB {
 	return AABB{vect.Vect{l, b}, vect.Vect{r, t}}
 }
 
+//returns an AABB holding a circle with the given center and radius.
+func NewAABBForCircle(p vect.Vect, r vect.Float) AABB {
+	return NewAABB(p.X-r, p.Y-r, p.X+r, p.Y+r)
+}
+
 //returns the center of the aabb
 func (aabb *AABB) Center() vect.Vect {
 	return vect.Mult(vect.Add(aabb.Lower, aabb.Upper), 0.5)
@@ -108,6 +113,44 @@ func Proximity(a, b AABB) vect.Float {
 	return vect.FAbs(a.Lower.X+a.Upper.X-b.Lower.X-b.Upper.X) + vect.FAbs(a.Lower.Y+a.Upper.Y-b.Lower.Y-b.Upper.Y)
 }
 
+//returns the fraction along the segment from a to b at which it enters the aabb, or Inf if it misses.
+func (aabb *AABB) SegmentQuery(a, b vect.Vect) vect.Float {
+	idx := 1 / (b.X - a.X)
+	tx1 := (aabb.Lower.X - a.X) * idx
+	if aabb.Lower.X == a.X {
+		tx1 = -Inf
+	}
+	tx2 := (aabb.Upper.X - a.X) * idx
+	if aabb.Upper.X == a.X {
+		tx2 = Inf
+	}
+	txmin := vect.FMin(tx1, tx2)
+	txmax := vect.FMax(tx1, tx2)
+
+	idy := 1 / (b.Y - a.Y)
+	ty1 := (aabb.Lower.Y - a.Y) * idy
+	if aabb.Lower.Y == a.Y {
+		ty1 = -Inf
+	}
+	ty2 := (aabb.Upper.Y - a.Y) * idy
+	if aabb.Upper.Y == a.Y {
+		ty2 = Inf
+	}
+	tymin := vect.FMin(ty1, ty2)
+	tymax := vect.FMax(ty1, ty2)
+
+	if tymin <= txmax && txmin <= tymax {
+		min := vect.FMax(txmin, tymin)
+		max := vect.FMin(txmax, tymax)
+
+		if 0 <= max && min <= 1 {
+			return vect.FMax(min, 0)
+		}
+	}
+
+	return Inf
+}
+
 func TestOverlap2(a, b AABB) bool {
 
 	d1 := vect.Sub(b.Lower, a.Upper)
@@ -27,6 +27,32 @@ const (
 // The maximum number of ContactPoints a single Arbiter can have.
 const MaxPoints = 4
 
+// A single contact point, as returned by queries and ContactPointSet.
+type ContactPoint struct {
+	// The position of the contact point.
+	Point vect.Vect
+	// The normal of the contact point.
+	Normal vect.Vect
+	// The depth of the contact point.
+	Dist vect.Float
+}
+
+// A struct that wraps up the important collision data for an arbiter.
+type ContactPointSet struct {
+	// The number of contact points in the set.
+	Count int
+	// The array of contact points.
+	Points [MaxPoints]ContactPoint
+}
+
+func newContactPointSet(contacts []*Contact) (set ContactPointSet) {
+	set.Count = len(contacts)
+	for i, con := range contacts {
+		set.Points[i] = ContactPoint{con.p, con.n, con.dist}
+	}
+	return
+}
+
 type Arbiter struct {
 	// The two colliding shapes.
 	ShapeA, ShapeB *Shape
@@ -50,6 +76,14 @@ type Arbiter struct {
 
 	state arbiterState
 	stamp time.Duration
+	// Index in Space.cachedArbitersOrder.
+	cacheIndex int
+
+	// Collision handlers looked up from the shapes' collision types.
+	handler            *CollisionHandler
+	handlerA, handlerB *CollisionHandler
+	handlerSwapped     bool
+	swapped            bool
 }
 
 func newArbiter() *Arbiter {
@@ -100,6 +134,27 @@ func (arb *Arbiter) update(a, b *Shape, contacts []*Contact, numContacts int) {
 	}
 }
 
+// Returns a contact set from the arbiter.
+func (arb *Arbiter) ContactPointSet() ContactPointSet {
+	return newContactPointSet(arb.Contacts[:arb.NumContacts])
+}
+
+// Returns the colliding shapes in the order of the collision handler being called.
+func (arb *Arbiter) Shapes() (a, b *Shape) {
+	if arb.swapped {
+		return arb.ShapeB, arb.ShapeA
+	}
+	return arb.ShapeA, arb.ShapeB
+}
+
+// Returns the colliding bodies in the order of the collision handler being called.
+func (arb *Arbiter) Bodies() (a, b *Body) {
+	if arb.swapped {
+		return arb.BodyB, arb.BodyA
+	}
+	return arb.BodyA, arb.BodyB
+}
+
 func (arb *Arbiter) Ignore() {
 	arb.state = arbiterStateIgnore
 }
@@ -234,7 +289,7 @@ func (arb *Arbiter) applyImpulse() {
 	b := arb.ShapeB.Body
 
 	for _, con := range arb.Contacts {
-		Impulse(a, b, con, arb.Surface_vr, float32(arb.u))
+		Impulse(a, b, con, arb.Surface_vr, arb.u)
 	}
 }
 */
@@ -244,6 +299,9 @@ func (arb *Arbiter) applyImpulse() {
 	b := arb.ShapeB.Body
 	vr := vect.Vect{}
 
+	// Bodies with infinite mass are only read so the parallel solver can share them between batches.
+	writeA, writeB := !a.isImmovable(), !b.isImmovable()
+
 	for _, con := range arb.Contacts {
 		n := con.n
 		r1 := con.r1
@@ -280,13 +338,17 @@ func (arb *Arbiter) applyImpulse() {
 		vr.X = n.X * jbnOld
 		vr.Y = n.Y * jbnOld
 
-		a.v_bias.X = (-vr.X * a.m_inv) + a.v_bias.X
-		a.v_bias.Y = (-vr.Y * a.m_inv) + a.v_bias.Y
-		a.w_bias += a.i_inv * ((r1.X * -vr.Y) - (r1.Y * -vr.X))
+		if writeA {
+			a.v_bias.X = (-vr.X * a.m_inv) + a.v_bias.X
+			a.v_bias.Y = (-vr.Y * a.m_inv) + a.v_bias.Y
+			a.w_bias += a.i_inv * ((r1.X * -vr.Y) - (r1.Y * -vr.X))
+		}
 
-		b.v_bias.X = (vr.X * b.m_inv) + b.v_bias.X
-		b.v_bias.Y = (vr.Y * b.m_inv) + b.v_bias.Y
-		b.w_bias += b.i_inv * ((r2.X * vr.Y) - (r2.Y * vr.X))
+		if writeB {
+			b.v_bias.X = (vr.X * b.m_inv) + b.v_bias.X
+			b.v_bias.Y = (vr.Y * b.m_inv) + b.v_bias.Y
+			b.w_bias += b.i_inv * ((r2.X * vr.Y) - (r2.Y * vr.X))
+		}
 
 		jnOld = con.jnAcc - jnOld
 		jtOld = con.jtAcc - jtOld
@@ -294,14 +356,18 @@ func (arb *Arbiter) applyImpulse() {
 		vr.X = (n.X * jnOld) - (n.Y * jtOld)
 		vr.Y = (n.X * jtOld) + (n.Y * jnOld)
 
-		a.v.X = (-vr.X * a.m_inv) + a.v.X
-		a.v.Y = (-vr.Y * a.m_inv) + a.v.Y
-		a.w += a.i_inv * ((r1.X * -vr.Y) - (r1.Y * -vr.X))
+		if writeA {
+			a.v.X = (-vr.X * a.m_inv) + a.v.X
+			a.v.Y = (-vr.Y * a.m_inv) + a.v.Y
+			a.w += a.i_inv * ((r1.X * -vr.Y) - (r1.Y * -vr.X))
+		}
 
-		b.v.X = (vr.X * b.m_inv) + b.v.X
-		b.v.Y = (vr.Y * b.m_inv) + b.v.Y
+		if writeB {
+			b.v.X = (vr.X * b.m_inv) + b.v.X
+			b.v.Y = (vr.Y * b.m_inv) + b.v.Y
 
-		b.w += b.i_inv * ((r2.X * vr.Y) - (r2.Y * vr.X))
+			b.w += b.i_inv * ((r2.X * vr.Y) - (r2.Y * vr.X))
+		}
 	}
 }
 
@@ -1,8 +1,9 @@
 package chipmunk
 
 import (
+	"github.com/vova616/chipmunk/transform"
 	"github.com/vova616/chipmunk/vect"
-	//. "github.com/vova616/chipmunk/transform" 
+	"log"
 	"math"
 )
 
@@ -17,8 +18,9 @@ type UpdatePositionFunction func(body *Body, dt vect.Float)
 type UpdateVelocityFunction func(body *Body, gravity vect.Vect, damping, dt vect.Float)
 
 const (
-	BodyType_Static  = BodyType(0)
-	BodyType_Dynamic = BodyType(1)
+	BodyType_Static    = BodyType(0)
+	BodyType_Dynamic   = BodyType(1)
+	BodyType_Kinematic = BodyType(2)
 )
 
 var Inf = vect.Float(math.Inf(1))
@@ -46,6 +48,8 @@ type Body struct {
 
 	/// Position of the rigid body's center of gravity.
 	p vect.Vect
+	// Center of gravity in body coordinates, the origin of the body is at p minus the rotated cog.
+	cog vect.Vect
 	/// Velocity of the rigid body's center of gravity.
 	v vect.Vect
 	/// Force acting on the rigid body's center of gravity.
@@ -87,6 +91,10 @@ type Body struct {
 
 	node ComponentNode
 
+	// Arbiters and constraints touching this body, rebuilt each step to form the contact graph.
+	arbiters    []*Arbiter
+	constraints []Constraint
+
 	hash HashValue
 
 	deleted bool
@@ -94,7 +102,20 @@ type Body struct {
 
 	idleTime vect.Float
 
+	// Kinematic bodies have infinite mass and are moved only by their velocity.
+	kinematic bool
+
 	IgnoreGravity bool
+
+	// Bullets are swept from their previous to their new position each step so fast bodies
+	// don't pass through thin shapes. Sweeping is more expensive than the regular collision detection.
+	Bullet bool
+
+	// The mass, moment and center of gravity are computed from the shapes.
+	autoMass bool
+
+	// Batches of the parallel solver writing and reading the body, only used while building the batches.
+	solverWrites, solverReads uint64
 }
 
 func NewBodyStatic() (body *Body) {
@@ -111,6 +132,21 @@ func NewBodyStatic() (body *Body) {
 	return
 }
 
+// Creates a body with infinite mass that is moved by setting its velocity,
+// useful for moving platforms and elevators.
+func NewBodyKinematic() (body *Body) {
+
+	body = &Body{}
+	body.Shapes = make([]*Shape, 0)
+	body.SetMass(Inf)
+	body.SetMoment(Inf)
+	body.kinematic = true
+	body.SetAngle(0)
+	body.Enabled = true
+
+	return
+}
+
 func NewBody(mass, i vect.Float) (body *Body) {
 
 	body = &Body{}
@@ -126,16 +162,48 @@ func NewBody(mass, i vect.Float) (body *Body) {
 func (body *Body) AddShape(shape *Shape) {
 	body.Shapes = append(body.Shapes, shape)
 	shape.Body = body
+	body.UpdateMass()
+}
+
+// Removes the shape from the body, and from the space if it was added to one.
+func (body *Body) RemoveShape(shape *Shape) {
+	if shape.Body != body {
+		return
+	}
+
+	if shape.space != nil {
+		shape.space.RemoveShape(shape)
+		return
+	}
+
+	body.removeShape(shape)
+	shape.Body = nil
+}
+
+func (body *Body) removeShape(shape *Shape) {
+	for i, s := range body.Shapes {
+		if s == shape {
+			body.Shapes = append(body.Shapes[:i], body.Shapes[i+1:]...)
+			break
+		}
+	}
+	body.UpdateMass()
 }
 
 func (body *Body) Clone() *Body {
 	clone := *body
-	clone.Shapes = make([]*Shape, 0)
+	clone.Shapes = make([]*Shape, 0, len(body.Shapes))
+	// The clone already has the mass of the shapes, they are not added with AddShape.
 	for _, shape := range body.Shapes {
-		clone.AddShape(shape.Clone())
+		shape = shape.Clone()
+		shape.Body = &clone
+		clone.Shapes = append(clone.Shapes, shape)
 	}
 	clone.space = nil
 	clone.hash = 0
+	clone.node = ComponentNode{}
+	clone.arbiters = nil
+	clone.constraints = nil
 	return &clone
 }
 
@@ -156,7 +224,7 @@ func (body *Body) SetMass(mass vect.Float) {
 		panic("Mass must be positive and non-zero.")
 	}
 
-	body.BodyActivate()
+	body.Activate()
 	body.m = mass
 	body.m_inv = 1 / mass
 }
@@ -166,13 +234,89 @@ func (body *Body) SetMoment(moment vect.Float) {
 		panic("Moment of Inertia must be positive and non-zero.")
 	}
 
-	body.BodyActivate()
+	body.Activate()
 	body.i = moment
 	body.i_inv = 1 / moment
 }
 
-func (body *Body) Moment() float32 {
-	return float32(body.i)
+func (body *Body) Moment() vect.Float {
+	return body.i
+}
+
+// Enables computing the mass, moment and center of gravity of a dynamic body from the mass of its shapes.
+// They are computed again whenever a shape is added, removed or resized, or its mass or density changes.
+// Disabling it keeps the current values.
+func (body *Body) SetAutoMass(auto bool) {
+	body.autoMass = auto
+	body.UpdateMass()
+}
+
+func (body *Body) AutoMass() bool {
+	return body.autoMass
+}
+
+// Recomputes the mass, moment and center of gravity of a dynamic body with automatic mass.
+// The origin of the body doesn't move. If the shapes have no mass the body keeps its mass and moment.
+func (body *Body) UpdateMass() {
+	if !body.autoMass || body.Type() != BodyType_Dynamic {
+		return
+	}
+
+	mass, moment, cog := vect.Float(0), vect.Float(0), vect.Vector_Zero
+	for _, shape := range body.Shapes {
+		m := shape.Mass()
+		if m <= 0 {
+			continue
+		}
+
+		// Move the moment to the combined center of gravity with the parallel axis theorem.
+		sum := mass + m
+		centroid := shape.ShapeClass.Centroid()
+		moment += shape.ShapeClass.centroidMoment(m) + vect.DistSqr(cog, centroid)*(m*mass)/sum
+		cog = vect.Add(cog, vect.Mult(vect.Sub(centroid, cog), m/sum))
+		mass = sum
+	}
+
+	if mass <= 0 {
+		return
+	}
+
+	body.SetMass(mass)
+	// A point mass has no moment, keep the current one.
+	if moment > 0 {
+		body.SetMoment(moment)
+	}
+	body.SetCenterOfGravity(cog)
+}
+
+// Returns the center of gravity in body coordinates.
+func (body *Body) CenterOfGravity() vect.Vect {
+	return body.cog
+}
+
+// Sets the center of gravity in body coordinates, the body rotates around it.
+// The origin of the body and its shapes don't move.
+func (body *Body) SetCenterOfGravity(cog vect.Vect) {
+	pos := body.Position()
+	body.cog = cog
+	body.p = vect.Add(pos, body.rotate(cog))
+}
+
+// Rotates v from body coordinates to world coordinates.
+func (body *Body) rotate(v vect.Vect) vect.Vect {
+	return transform.RotateVect(v, transform.Rotation{body.rot.X, body.rot.Y})
+}
+
+// Returns the transform from body coordinates to world coordinates.
+func (body *Body) transform() transform.Transform {
+	return body.transformAt(body.p, body.a)
+}
+
+// Returns the transform of the body with its center of gravity at p and rotated by angle.
+func (body *Body) transformAt(p vect.Vect, angle vect.Float) transform.Transform {
+	xf := transform.NewTransform(p, angle)
+	xf.Position = vect.Sub(p, xf.RotateVect(body.cog))
+	return xf
 }
 
 func (body *Body) MomentIsInf() bool {
@@ -180,12 +324,12 @@ func (body *Body) MomentIsInf() bool {
 }
 
 func (body *Body) SetAngle(angle vect.Float) {
-	body.BodyActivate()
+	body.Activate()
 	body.setAngle(angle)
 }
 
-func (body *Body) AddAngle(angle float32) {
-	body.SetAngle(vect.Float(angle) + body.Angle())
+func (body *Body) AddAngle(angle vect.Float) {
+	body.SetAngle(angle + body.Angle())
 }
 
 func (body *Body) Mass() vect.Float {
@@ -197,14 +341,73 @@ func (body *Body) setAngle(angle vect.Float) {
 	body.rot = vect.FromAngle(angle)
 }
 
+// Deprecated: use Activate instead.
 func (body *Body) BodyActivate() {
-	//TODO: make it work with sleeping
+	body.Activate()
+}
+
+// Wakes up a sleeping or idle body and the component it belongs to.
+func (body *Body) Activate() {
 	if body.IsStatic() {
 		return
 	}
 
 	if !body.IsRogue() {
 		body.node.IdleTime = 0
+		body.ComponentRoot().componentActivate()
+	}
+
+	for _, arb := range body.arbiters {
+		// Reset the idle timer of things the body is touching as well.
+		// That way things don't get left hanging in the air.
+		other := arb.BodyA
+		if other == body {
+			other = arb.BodyB
+		}
+		if !other.IsStatic() {
+			other.node.IdleTime = 0
+		}
+	}
+}
+
+// Forces a body to fall asleep immediately even if it's in midair.
+// Cannot be called from a callback.
+func (body *Body) Sleep() {
+	body.SleepWithGroup(nil)
+}
+
+// Forces a body to fall asleep immediately along with other bodies in the group.
+// group must be a sleeping body or nil.
+func (body *Body) SleepWithGroup(group *Body) {
+	if body.IsRogue() || body.IsStatic() || body.kinematic {
+		panic("Rogue (static and kinematic) bodies cannot be put to sleep.")
+	}
+	if group != nil && !group.IsSleeping() {
+		panic("Cannot use a non-sleeping body as a group identifier.")
+	}
+
+	if body.IsSleeping() {
+		if group != nil && body.ComponentRoot() != group.ComponentRoot() {
+			panic("The body is already sleeping and it's group cannot be reassigned.")
+		}
+		return
+	}
+
+	space := body.space
+	if space.IsLocked() {
+		panic("Bodies can not be put to sleep during a query or a call to Space.Step(). Put these calls into a post-step callback.")
+	}
+
+	body.UpdateShapes()
+	space.deactivateBody(body)
+
+	if group != nil {
+		root := group.ComponentRoot()
+		body.node = ComponentNode{Root: root, Next: root.node.Next}
+		root.node.Next = body
+	} else {
+		body.node = ComponentNode{Root: body}
+		space.sleepingComponents = append(space.sleepingComponents, body)
 	}
 }
 
@@ -215,11 +418,23 @@ func (body *Body) ComponentRoot() *Body {
 	return nil
 }
 
-func (body *Body) ComponentActive() {
-	if body.IsSleeping() || body.IsRogue() {
+// Returns true if any body in the component rooted at body has been idle for less than threshold.
+func (body *Body) ComponentActive(threshold vect.Float) bool {
+	for b := body; b != nil; b = b.node.Next {
+		if b.node.IdleTime < threshold {
+			return true
+		}
+	}
+	return false
+}
+
+func (body *Body) componentActivate() {
+	if body == nil || !body.IsSleeping() {
 		return
 	}
-	return
+	if body.IsRogue() {
+		panic("Internal Error: componentActivate() called on a rogue body.")
+	}
 
 	space := body.space
 	b := body
@@ -229,13 +444,75 @@ func (body *Body) ComponentActive() {
 		b.node.IdleTime = 0
 		b.node.Root = nil
 		b.node.Next = nil
-		space.ActiveBody(body)
+		space.ActiveBody(b)
 
 		b = next
 	}
 
-	//for i,sleeping
-	//cpArrayDeleteObj(space->sleepingComponents, root);
+	for i, root := range space.sleepingComponents {
+		if root == body {
+			last := len(space.sleepingComponents) - 1
+			space.sleepingComponents[i], space.sleepingComponents = space.sleepingComponents[last], space.sleepingComponents[:last]
+			break
+		}
+	}
+}
+
+func (body *Body) componentAdd(root *Body) {
+	body.node.Root = root
+
+	if body != root {
+		body.node.Next = root.node.Next
+		root.node.Next = body
+	}
+}
+
+// Performs a DFS to flood fill mark the component in the contact graph using root.
+func (body *Body) floodFillComponent(root *Body) {
+	// Rogue and kinematic bodies cannot be put to sleep and prevent bodies they are touching from sleeping anyway.
+	// Static bodies are effectively sleeping all the time.
+	if body.IsRogue() || body.IsStatic() || body.kinematic {
+		return
+	}
+
+	otherRoot := body.ComponentRoot()
+	if otherRoot == nil {
+		body.componentAdd(root)
+		for _, arb := range body.arbiters {
+			if body == arb.BodyA {
+				arb.BodyB.floodFillComponent(root)
+			} else {
+				arb.BodyA.floodFillComponent(root)
+			}
+		}
+		for _, constraint := range body.constraints {
+			con := constraint.Constraint()
+			if body == con.BodyA {
+				con.BodyB.floodFillComponent(root)
+			} else {
+				con.BodyA.floodFillComponent(root)
+			}
+		}
+	} else if otherRoot != root {
+		log.Printf("Internal Error: Inconsistency detected in the contact graph.")
+	}
+}
+
+func (body *Body) pushArbiter(arb *Arbiter) {
+	if body.IsStatic() || body.IsRogue() {
+		return
+	}
+	body.arbiters = append(body.arbiters, arb)
+}
+
+func (body *Body) removeConstraint(constraint Constraint) {
+	for i, c := range body.constraints {
+		if c == constraint {
+			last := len(body.constraints) - 1
+			body.constraints[i], body.constraints = body.constraints[last], body.constraints[:last]
+			return
+		}
+	}
 }
 
 func (body *Body) IsRogue() bool {
@@ -250,90 +527,198 @@ func (body *Body) IsStatic() bool {
 	return math.IsInf(float64(body.node.IdleTime), 0)
 }
 
+// Returns true if impulses can't change the velocity of the body.
+func (body *Body) isImmovable() bool {
+	return body.m_inv == 0 && body.i_inv == 0
+}
+
+func (body *Body) IsKinematic() bool {
+	return body.kinematic
+}
+
+func (body *Body) Type() BodyType {
+	if body.IsStatic() {
+		return BodyType_Static
+	}
+	if body.kinematic {
+		return BodyType_Kinematic
+	}
+	return BodyType_Dynamic
+}
+
+// Converts the body to the given type, moving it between the space's bodies and spatial indexes if needed.
+// Static and kinematic bodies get infinite mass and lose their velocity.
+// A body converted to dynamic keeps a finite mass and moment, otherwise they are set to 1
+// and should be changed with SetMass and SetMoment, unless the body has automatic mass.
+// A static body converted to another type is affected by gravity again, IgnoreGravity is otherwise kept.
+// The arbiters of the body are removed, calling their separate callbacks.
+func (body *Body) SetType(t BodyType) {
+	oldType := body.Type()
+	if oldType == t {
+		return
+	}
+
+	if body.space != nil {
+		body.space.assertUnlocked()
+	}
+
+	if oldType != BodyType_Static {
+		body.Activate()
+	}
+
+	body.kinematic = t == BodyType_Kinematic
+	if oldType == BodyType_Static {
+		// Set by NewBodyStatic.
+		body.IgnoreGravity = false
+	}
+	if t == BodyType_Static {
+		body.node.IdleTime = Inf
+	} else {
+		body.node.IdleTime = 0
+	}
+
+	if t == BodyType_Dynamic {
+		if math.IsInf(float64(body.m), 0) {
+			body.m, body.m_inv = 1, 1
+		}
+		if math.IsInf(float64(body.i), 0) {
+			body.i, body.i_inv = 1, 1
+		}
+		body.UpdateMass()
+	} else {
+		body.m, body.m_inv = Inf, 0
+		body.i, body.i_inv = Inf, 0
+		body.v = vect.Vector_Zero
+		body.w = 0
+	}
+
+	space := body.space
+	if space == nil {
+		return
+	}
+
+	// The arbiters were made for the old type, the shapes collide again on the next step.
+	space.filterArbiters(body)
+
+	// Static bodies are not part of the simulated bodies and their shapes live in the static index.
+	if oldType == BodyType_Static {
+		space.Bodies = append(space.Bodies, body)
+		for _, shape := range body.Shapes {
+			space.staticShapes.Remove(shape)
+			space.activeShapes.Insert(shape)
+		}
+	} else if t == BodyType_Static {
+		for i, pbody := range space.Bodies {
+			if pbody == body {
+				last := len(space.Bodies) - 1
+				space.Bodies[i], space.Bodies = space.Bodies[last], space.Bodies[:last]
+				break
+			}
+		}
+		body.arbiters = body.arbiters[0:0]
+		for _, shape := range body.Shapes {
+			shape.Update()
+			space.activeShapes.Remove(shape)
+			space.staticShapes.Insert(shape)
+		}
+	}
+}
+
 func (body *Body) UpdateShapes() {
 	for _, shape := range body.Shapes {
 		shape.Update()
 	}
 }
 
+// Moves the origin of the body to pos.
 func (body *Body) SetPosition(pos vect.Vect) {
-	body.p = pos
+	body.Activate()
+	body.p = vect.Add(pos, body.rotate(body.cog))
 }
 
-func (body *Body) AddForce(x, y float32) {
-	body.f.X += vect.Float(x)
-	body.f.Y += vect.Float(y)
+func (body *Body) AddForce(x, y vect.Float) {
+	body.Activate()
+	body.f.X += x
+	body.f.Y += y
 }
 
-func (body *Body) SetForce(x, y float32) {
-	body.f.X = vect.Float(x)
-	body.f.Y = vect.Float(y)
+func (body *Body) SetForce(x, y vect.Float) {
+	body.Activate()
+	body.f.X = x
+	body.f.Y = y
 }
 
-func (body *Body) AddVelocity(x, y float32) {
-	body.v.X += vect.Float(x)
-	body.v.Y += vect.Float(y)
+func (body *Body) AddVelocity(x, y vect.Float) {
+	body.Activate()
+	body.v.X += x
+	body.v.Y += y
 }
 
-func (body *Body) SetVelocity(x, y float32) {
-	body.v.X = vect.Float(x)
-	body.v.Y = vect.Float(y)
+func (body *Body) SetVelocity(x, y vect.Float) {
+	body.Activate()
+	body.v.X = x
+	body.v.Y = y
 }
 
-func (body *Body) AddTorque(t float32) {
-	body.t += vect.Float(t)
+func (body *Body) AddTorque(t vect.Float) {
+	body.Activate()
+	body.t += t
 }
 
-func (body *Body) Torque() float32 {
-	return float32(body.t)
+func (body *Body) Torque() vect.Float {
+	return body.t
 }
 
 func (body *Body) VBias() vect.Vect {
 	return body.v_bias
 }
 
-func (body *Body) WBias() float32 {
-	return float32(body.w_bias)
+func (body *Body) WBias() vect.Float {
+	return body.w_bias
 }
 
 func (body *Body) SetVBias(v vect.Vect) {
 	body.v_bias = v
 }
 
-func (body *Body) SetWBias(w float32) {
-	body.w_bias = vect.Float(w)
+func (body *Body) SetWBias(w vect.Float) {
+	body.w_bias = w
 }
 
-func (body *Body) AngularVelocity() float32 {
-	return float32(body.w)
+func (body *Body) AngularVelocity() vect.Float {
+	return body.w
 }
 
-func (body *Body) SetTorque(t float32) {
-	body.t = vect.Float(t)
+func (body *Body) SetTorque(t vect.Float) {
+	body.Activate()
+	body.t = t
 }
 
-func (body *Body) AddAngularVelocity(w float32) {
-	body.w += vect.Float(w)
+func (body *Body) AddAngularVelocity(w vect.Float) {
+	body.Activate()
+	body.w += w
 }
 
-func (body *Body) SetAngularVelocity(w float32) {
-	body.w = vect.Float(w)
+func (body *Body) SetAngularVelocity(w vect.Float) {
+	body.Activate()
+	body.w = w
 }
 
 func (body *Body) Velocity() vect.Vect {
 	return body.v
 }
 
+// Returns the position of the origin of the body.
 func (body *Body) Position() vect.Vect {
-	return body.p
+	return vect.Sub(body.p, body.rotate(body.cog))
 }
 
 func (body *Body) Angle() vect.Float {
 	return body.a
 }
 
-func (body *Body) Rot() (rx, ry float32) {
-	return float32(body.rot.X), float32(body.rot.Y)
+func (body *Body) Rot() (rx, ry vect.Float) {
+	return body.rot.X, body.rot.Y
 }
 
 func (body *Body) UpdatePosition(dt vect.Float) {
@@ -357,6 +742,11 @@ func (body *Body) updateVelocityProxy(gravity vect.Vect, damping, dt vect.Float)
 }
 
 func (body *Body) UpdateVelocity(gravity vect.Vect, damping, dt vect.Float) {
+	// Kinematic bodies are only moved by the velocity set by the user.
+	if body.kinematic {
+		return
+	}
+
 	body.v = vect.Add(vect.Mult(body.v, damping), vect.Mult(vect.Add(gravity, vect.Mult(body.f, body.m_inv)), dt))
 
 	body.w = (body.w * damping) + (body.t * body.i_inv * dt)
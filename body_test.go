@@ -0,0 +1,224 @@
+package chipmunk
+
+import (
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+func checkMass(t *testing.T, name string, body *Body, mass, moment vect.Float, cog vect.Vect) {
+	if !nearlyEqual(body.Mass(), mass) {
+		t.Errorf("%s: mass is %v, want %v", name, body.Mass(), mass)
+	}
+	if !nearlyEqual(body.Moment(), moment) {
+		t.Errorf("%s: moment is %v, want %v", name, body.Moment(), moment)
+	}
+	if got := body.CenterOfGravity(); !nearlyEqual(got.X, cog.X) || !nearlyEqual(got.Y, cog.Y) {
+		t.Errorf("%s: center of gravity is %v, want %v", name, got, cog)
+	}
+}
+
+func TestAutoMassL(t *testing.T) {
+	// A 20x20 L of width 10: a 20x10 box at the bottom and a 10x10 box on its left.
+	mass, moment, cog := vect.Float(300), vect.Float(55000.0/3), vect.Vect{25.0 / 3, 25.0 / 3}
+
+	boxes := NewBody(1, 1)
+	boxes.SetAutoMass(true)
+	for _, box := range []*Shape{NewBox(vect.Vect{10, 5}, 20, 10), NewBox(vect.Vect{5, 15}, 10, 10)} {
+		box.SetDensity(1)
+		boxes.AddShape(box)
+	}
+	checkMass(t, "boxes", boxes, mass, moment, cog)
+
+	poly := NewBody(1, 1)
+	poly.SetAutoMass(true)
+	_, err := poly.AddConcavePolygon(Vertices{{0, 0}, {20, 0}, {20, 10}, {10, 10}, {10, 20}, {0, 20}}, nil, vect.Vector_Zero, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMass(t, "concave polygon", poly, mass, moment, cog)
+
+	// The origin of the body stays where it was, its center of gravity moves.
+	poly.SetPosition(vect.Vect{100, 100})
+	if got := poly.p; !nearlyEqual(got.X, 100+cog.X) || !nearlyEqual(got.Y, 100+cog.Y) {
+		t.Errorf("center of gravity is at %v in the world, want %v", got, vect.Add(vect.Vect{100, 100}, cog))
+	}
+}
+
+func TestAutoMassShapes(t *testing.T) {
+	body := NewBody(1, 1)
+	body.SetAutoMass(true)
+
+	circle := NewCircle(vect.Vect{2, 0}, 1)
+	circle.SetMass(2)
+	body.AddShape(circle)
+	checkMass(t, "circle", body, 2, 1, vect.Vect{2, 0})
+
+	circle.GetAsCircle().SetRadius(2)
+	checkMass(t, "resized circle", body, 2, 4, vect.Vect{2, 0})
+
+	// Segments with a radius get the mass of their area, the moment of a segment extended by the radius.
+	segmentShape := NewSegment(vect.Vect{-2, 0}, vect.Vect{2, 0}, 0)
+	segmentShape.SetMass(3)
+	segmentBody := NewBody(1, 1)
+	segmentBody.SetAutoMass(true)
+	segmentBody.AddShape(segmentShape)
+	checkMass(t, "segment", segmentBody, 3, 4, vect.Vector_Zero)
+
+	segment := segmentShape.GetAsSegment()
+	segment.SetRadius(1)
+	checkMass(t, "segment with a radius", segmentBody, 3, 10, vect.Vector_Zero)
+
+	segment.SetEndpoints(vect.Vect{0, 0}, vect.Vect{4, 0})
+	checkMass(t, "moved segment", segmentBody, 3, 10, vect.Vect{2, 0})
+
+	segmentShape.SetDensity(2)
+	mass := 2 * AreaForSegment(segment.A, segment.B, 1)
+	checkMass(t, "dense segment", segmentBody, mass, mass*(36+4)/12, vect.Vect{2, 0})
+
+	// Bodies without automatic mass keep their mass.
+	manual := NewBody(5, 7)
+	manual.AddShape(NewCircle(vect.Vector_Zero, 10))
+	checkMass(t, "manual", manual, 5, 7, vect.Vector_Zero)
+}
+
+func indexContains(index *SpatialIndex, shape *Shape) bool {
+	found := false
+	index.Each(func(node *Node) {
+		found = found || node.obj.Shape() == shape
+	})
+	return found
+}
+
+func TestKinematicPushesBodies(t *testing.T) {
+	space, _ := floorScene()
+
+	// An elevator lifting a box.
+	elevator := NewBodyKinematic()
+	elevator.AddShape(NewBox(vect.Vector_Zero, 40, 4))
+	elevator.SetPosition(vect.Vect{0, 10})
+	elevator.SetVelocity(0, 20)
+	space.AddBody(elevator)
+	box := addBox(space, vect.Vect{0, 17}, 10)
+
+	for i := 0; i < 120; i++ {
+		space.Step(1.0 / 60)
+	}
+
+	// The elevator isn't slowed down by the box or gravity.
+	if v := elevator.Velocity(); v != (vect.Vect{0, 20}) {
+		t.Errorf("elevator velocity changed to %v", v)
+	}
+	if y := elevator.Position().Y; !nearlyEqual(y, 50) {
+		t.Errorf("elevator is at %v, want 50", y)
+	}
+	if y := box.Position().Y; y < 55 || y > 60 {
+		t.Errorf("box is at %v, want it resting on the elevator at 57", y)
+	}
+	if elevator.IsSleeping() {
+		t.Errorf("kinematic body fell asleep")
+	}
+}
+
+func TestKinematicIgnoresStatic(t *testing.T) {
+	space, floor := floorScene()
+
+	// A kinematic body moving through the floor.
+	platform := NewBodyKinematic()
+	platform.AddShape(NewBox(vect.Vector_Zero, 40, 4))
+	platform.SetVelocity(10, -10)
+	space.AddBody(platform)
+
+	begins := 0
+	space.AddWildcardHandler(0).BeginFunc = func(arb *Arbiter, space *Space) bool {
+		begins++
+		return true
+	}
+
+	for i := 0; i < 60; i++ {
+		space.Step(1.0 / 60)
+		for _, arb := range space.Arbiters {
+			if arb.BodyA == floor || arb.BodyB == floor {
+				t.Fatalf("the kinematic body collided with the static floor")
+			}
+		}
+	}
+	if begins != 0 {
+		t.Errorf("%d begin callbacks between a kinematic and a static body", begins)
+	}
+	if p := platform.Position(); !nearlyEqual(p.X, 10) || !nearlyEqual(p.Y, -10) {
+		t.Errorf("kinematic body is at %v, want {10 -10}", p)
+	}
+}
+
+func TestSetTypeInSpace(t *testing.T) {
+	space, _ := floorScene()
+	separates := 0
+	space.AddCollisionHandler(0, 0).SeparateFunc = func(arb *Arbiter, space *Space) {
+		separates++
+	}
+
+	box := addBox(space, vect.Vect{0, 5}, 10)
+	for i := 0; i < 30; i++ {
+		space.Step(1.0 / 60)
+	}
+
+	// Static bodies are moved out of the simulated bodies and into the static index.
+	box.SetType(BodyType_Static)
+	if separates != 1 {
+		t.Errorf("%d separate callbacks when the box became static, want 1", separates)
+	}
+	if containsBody(space.Bodies, box) || !indexContains(space.staticShapes, box.Shapes[0]) ||
+		indexContains(space.activeShapes, box.Shapes[0]) {
+		t.Errorf("static box is not indexed as a static body")
+	}
+	box.SetPosition(vect.Vect{0, 50})
+	space.ReindexShape(box.Shapes[0])
+	for i := 0; i < 30; i++ {
+		space.Step(1.0 / 60)
+	}
+	if y := box.Position().Y; y != 50 {
+		t.Errorf("static box moved to %v", y)
+	}
+
+	// A static body made dynamic falls.
+	box.SetType(BodyType_Dynamic)
+	if !containsBody(space.Bodies, box) || !indexContains(space.activeShapes, box.Shapes[0]) ||
+		indexContains(space.staticShapes, box.Shapes[0]) {
+		t.Errorf("dynamic box is not indexed as a dynamic body")
+	}
+	if box.Mass() != 1 || box.Moment() != 1 {
+		t.Errorf("dynamic box has mass %v and moment %v, want 1 and 1", box.Mass(), box.Moment())
+	}
+	space.Step(1.0 / 60)
+	if box.Velocity().Y >= 0 {
+		t.Errorf("box made dynamic doesn't fall")
+	}
+
+	// A dynamic body ignoring gravity keeps ignoring it after being kinematic.
+	floating := addBox(space, vect.Vect{100, 50}, 10)
+	floating.IgnoreGravity = true
+	floating.SetType(BodyType_Kinematic)
+	space.Step(1.0 / 60)
+	floating.SetType(BodyType_Dynamic)
+	for i := 0; i < 30; i++ {
+		space.Step(1.0 / 60)
+	}
+	if y := floating.Position().Y; y != 50 {
+		t.Errorf("body ignoring gravity fell to %v", y)
+	}
+
+	// A kinematic body made dynamic falls.
+	kinematic := NewBodyKinematic()
+	kinematic.AddShape(NewCircle(vect.Vector_Zero, 5))
+	kinematic.SetPosition(vect.Vect{200, 50})
+	space.AddBody(kinematic)
+	space.Step(1.0 / 60)
+	kinematic.SetType(BodyType_Dynamic)
+	for i := 0; i < 30; i++ {
+		space.Step(1.0 / 60)
+	}
+	if y := kinematic.Position().Y; y >= 50 {
+		t.Errorf("kinematic body made dynamic doesn't fall, it is at %v", y)
+	}
+}
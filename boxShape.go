@@ -1,6 +1,8 @@
 package chipmunk
 
 import (
+	"encoding/json"
+
 	"github.com/vova616/chipmunk/transform"
 	"github.com/vova616/chipmunk/vect"
 )
@@ -55,8 +57,20 @@ func NewBox(pos vect.Vect, w, h vect.Float) *Shape {
 	return shape
 }
 
-func (box *BoxShape) Moment(mass float32) vect.Float {
-	return (vect.Float(mass) * (box.Width*box.Width + box.Height*box.Height) / 12.0)
+func (box *BoxShape) Moment(mass vect.Float) vect.Float {
+	return box.centroidMoment(mass) + mass*vect.LengthSqr(box.Position)
+}
+
+func (box *BoxShape) Area() vect.Float {
+	return vect.FAbs(box.Width * box.Height)
+}
+
+func (box *BoxShape) Centroid() vect.Vect {
+	return box.Position
+}
+
+func (box *BoxShape) centroidMoment(mass vect.Float) vect.Float {
+	return MomentForBox(mass, box.Width, box.Height)
 }
 
 // Recalculates the internal Polygon with the Width, Height and Position.
@@ -105,3 +119,41 @@ func (box *BoxShape) update(xf transform.Transform) AABB {
 func (box *BoxShape) TestPoint(point vect.Vect) bool {
 	return box.Polygon.TestPoint(point)
 }
+
+func (box *BoxShape) segmentQuery(a, b vect.Vect, info *SegmentQueryInfo) {
+	box.Polygon.segmentQuery(a, b, info)
+}
+
+func (box *BoxShape) nearestPointQuery(p vect.Vect) NearestPointQueryInfo {
+	return box.Polygon.nearestPointQuery(p)
+}
+
+type boxData struct {
+	Position      vect.Vect
+	Width, Height vect.Float
+}
+
+func (box *BoxShape) marshalShape(shape *Shape) ([]byte, error) {
+	return json.Marshal(&boxData{box.Position, box.Width, box.Height})
+}
+
+func (box *BoxShape) unmarshalShape(shape *Shape, data []byte) error {
+	bData := boxData{}
+
+	err := json.Unmarshal(data, &bData)
+	if err != nil {
+		return err
+	}
+
+	box.Position = bData.Position
+	box.Width = bData.Width
+	box.Height = bData.Height
+	box.Shape = shape
+	if box.Polygon == nil {
+		box.Polygon = &PolygonShape{}
+	}
+	box.Polygon.Shape = shape
+	box.UpdatePoly()
+	shape.ShapeClass = box
+	return nil
+}
@@ -0,0 +1,173 @@
+package chipmunk
+
+import (
+	"math"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Number of bisections used to refine the time of impact once a sample collided.
+const bulletBisections = 12
+
+// Maximum number of samples of the motion of a bullet shape in a step. A shape moving further than this many times
+// its thickness in a step is sampled in larger steps and can pass through thin shapes.
+const bulletMaxSamples = 128
+
+// Position of a bullet body before it was integrated.
+type bulletMotion struct {
+	body *Body
+	p    vect.Vect
+	a    vect.Float
+}
+
+// Sweeps the shapes of the bullet bodies from their previous to their new transform and moves every body
+// that hit something back to its time of impact, the collision is then found by the regular collision detection.
+// The bodies keep their velocities, the contact solver stops them.
+func (space *Space) sweepBullets(bullets []bulletMotion) {
+	for _, motion := range bullets {
+		body := motion.body
+
+		p1, a1 := body.p, body.a
+		toi := vect.Float(1)
+		for _, shape := range body.Shapes {
+			toi = space.shapeTimeOfImpact(shape, motion.p, p1, motion.a, a1, toi)
+		}
+
+		if toi < 1 {
+			body.p = vect.Add(motion.p, vect.Mult(vect.Sub(p1, motion.p), toi))
+			body.setAngle(motion.a + (a1-motion.a)*toi)
+		}
+		body.UpdateShapes()
+	}
+}
+
+// Returns the first time in [0, maxT) at which the shape moving from (p0, a0) to (p1, a1) collides with another shape,
+// or maxT if it doesn't. Shapes already touching the shape at its starting transform are ignored.
+// The motion is sampled in steps smaller than the thickness of the shape so it can't pass through anything.
+func (space *Space) shapeTimeOfImpact(shape *Shape, p0, p1 vect.Vect, a0, a1, maxT vect.Float) vect.Float {
+	if shape.IsSensor {
+		return maxT
+	}
+
+	bb0 := shape.ShapeClass.update(shape.Body.transformAt(p0, a0))
+	bb1 := shape.ShapeClass.update(shape.Body.transformAt(p1, a1))
+
+	// Any point of the shape stays within radius of the center of gravity.
+	radius := vect.Float(0)
+	for _, corner := range []vect.Vect{bb0.Lower, bb0.Upper, {bb0.Lower.X, bb0.Upper.Y}, {bb0.Upper.X, bb0.Lower.Y}} {
+		radius = vect.FMax(radius, vect.Dist(corner, p0))
+	}
+
+	distance := vect.Dist(p0, p1) + vect.FAbs(a1-a0)*radius
+	step := vect.FMax(shapeThickness(shape), space.collisionSlop)
+	samples := math.Ceil(float64(distance / step))
+	if samples <= 1 {
+		// Moving less than its thickness, the regular collision detection can't miss anything.
+		return maxT
+	}
+
+	sweptBB := Combine(bb0, bb1)
+	if a0 != a1 {
+		sweptBB = Combine(NewAABBForCircle(p0, radius), NewAABBForCircle(p1, radius))
+	}
+
+	contacts := space.pullContactBuffer()
+	defer space.pushContactBuffer(contacts)
+
+	// Collect the shapes the swept shape could hit, dropping the ones it already touches.
+	shape.BB = shape.ShapeClass.update(shape.Body.transformAt(p0, a0))
+	var others []*Shape
+	query := func(_, b Indexable) {
+		other := b.Shape()
+		if other.IsSensor || other.Body == shape.Body || queryRejectShapes(shape, other) {
+			return
+		}
+		if math.IsInf(float64(shape.Body.m), 0) && math.IsInf(float64(other.Body.m), 0) {
+			return
+		}
+		if TestOverlapPtr(&shape.BB, &other.BB) && collide(contacts, shape, other) > 0 {
+			return
+		}
+		others = append(others, other)
+	}
+	space.staticShapes.Query(nil, sweptBB, query)
+	space.activeShapes.Query(nil, sweptBB, query)
+
+	if len(others) == 0 {
+		return maxT
+	}
+
+	collidesAt := func(t vect.Float) bool {
+		p := vect.Add(p0, vect.Mult(vect.Sub(p1, p0), t))
+		shape.BB = shape.ShapeClass.update(shape.Body.transformAt(p, a0+(a1-a0)*t))
+		for _, other := range others {
+			if TestOverlapPtr(&shape.BB, &other.BB) && collide(contacts, shape, other) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Each sample updates the shape and tests it against every candidate, bound their number.
+	samples = math.Min(samples, bulletMaxSamples)
+
+	toi := maxT
+	for i := 1; i <= int(samples); i++ {
+		t := vect.Float(i) / vect.Float(samples)
+		if t >= maxT {
+			t = maxT
+		}
+
+		if collidesAt(t) {
+			// Bisect between the last free sample and this one, keeping the colliding side
+			// so the regular collision detection finds the contact.
+			lo, hi := vect.Float(i-1)/vect.Float(samples), t
+			for j := 0; j < bulletBisections; j++ {
+				mid := (lo + hi) / 2
+				if collidesAt(mid) {
+					hi = mid
+				} else {
+					lo = mid
+				}
+			}
+			toi = hi
+			break
+		}
+
+		if t == maxT {
+			break
+		}
+	}
+
+	return toi
+}
+
+// Returns the distance the shape can move without passing through a shape of no thickness.
+func shapeThickness(shape *Shape) vect.Float {
+	switch class := shape.ShapeClass.(type) {
+	case *CircleShape:
+		return class.Radius
+	case *SegmentShape:
+		return class.Radius
+	case *BoxShape:
+		return vect.FMin(vect.FAbs(class.Width), vect.FAbs(class.Height)) / 2
+	case *PolygonShape:
+		if class.NumVerts == 0 {
+			return 0
+		}
+
+		// Distance from the centroid of the vertices to the closest edge.
+		centroid := vect.Vector_Zero
+		for _, v := range class.Verts {
+			centroid = vect.Add(centroid, v)
+		}
+		centroid = vect.Mult(centroid, 1/vect.Float(class.NumVerts))
+
+		thickness := Inf
+		for _, axis := range class.Axes {
+			thickness = vect.FMin(thickness, axis.D-vect.Dot(axis.N, centroid))
+		}
+		return vect.FMax(thickness, 0)
+	}
+	return 0
+}
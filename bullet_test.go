@@ -0,0 +1,41 @@
+package chipmunk
+
+import (
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Shoots a small circle at a thin wall at x = 500, returns the final x of the circle.
+func shootAtWall(bullet bool, speed vect.Float) vect.Float {
+	space := NewSpace()
+
+	wall := NewBodyStatic()
+	wall.AddShape(NewSegment(vect.Vect{500, -100}, vect.Vect{500, 100}, 0))
+	space.AddBody(wall)
+
+	shape := NewCircle(vect.Vector_Zero, 2)
+	shape.SetElasticity(1)
+	body := NewBody(1, shape.Moment(1))
+	body.AddShape(shape)
+	// Start so that no step ends with the circle touching the wall.
+	body.SetPosition(vect.Vect{-37, 0})
+	body.SetVelocity(speed, 0)
+	body.Bullet = bullet
+	space.AddBody(body)
+
+	for i := 0; i < 10; i++ {
+		space.Step(1.0 / 60)
+	}
+	return body.Position().X
+}
+
+func TestBulletTunnelling(t *testing.T) {
+	// The circle moves 100 units per step, 50 times its radius.
+	if x := shootAtWall(false, 6000); x < 500 {
+		t.Fatalf("the circle didn't pass through the wall without continuous collision detection, it is at %v", x)
+	}
+	if x := shootAtWall(true, 6000); x >= 500 {
+		t.Errorf("the bullet passed through the wall, it is at %v", x)
+	}
+}
@@ -133,7 +133,7 @@ import (
 	"unsafe"
 )
 
-func Impulse(a, b *Body, con *Contact, surf Vect, u float32) {
+func Impulse(a, b *Body, con *Contact, surf Vect, u Float) {
 	C.Impulse(
 		(*C.Body)(unsafe.Pointer(a)),
 		(*C.Body)(unsafe.Pointer(b)),
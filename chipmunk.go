@@ -1,2 +1,90 @@
 // chipmunk project chipmunk.go
 package chipmunk
+
+import (
+	"github.com/vova616/chipmunk/vect"
+	"math"
+)
+
+// Calculate the moment of inertia for a circle.
+// r1 and r2 are the inner and outer radii. A solid circle has an inner radius of 0.
+func MomentForCircle(m, r1, r2 vect.Float, offset vect.Vect) vect.Float {
+	return m * (0.5*(r1*r1+r2*r2) + vect.LengthSqr(offset))
+}
+
+// Calculate area of a hollow circle.
+// r1 and r2 are the inner and outer radii. A solid circle has an inner radius of 0.
+func AreaForCircle(r1, r2 vect.Float) vect.Float {
+	return math.Pi * vect.FAbs(r1*r1-r2*r2)
+}
+
+// Calculate the moment of inertia for a line segment with the given beveling radius.
+// The rounded ends are approximated by extending the segment by r at both ends, like Chipmunk 7 does.
+func MomentForSegment(m vect.Float, a, b vect.Vect, r vect.Float) vect.Float {
+	offset := vect.Mult(vect.Add(a, b), 0.5)
+	return momentForSegmentCentroid(m, a, b, r) + m*vect.LengthSqr(offset)
+}
+
+// Calculate the moment of inertia for a line segment around its center.
+func momentForSegmentCentroid(m vect.Float, a, b vect.Vect, r vect.Float) vect.Float {
+	length := vect.Dist(b, a) + 2*r
+	return m * (length*length + 4*r*r) / 12
+}
+
+// Calculate the area of a fattened (capsule shaped) line segment.
+func AreaForSegment(a, b vect.Vect, r vect.Float) vect.Float {
+	return r * (math.Pi*r + 2*vect.Dist(a, b))
+}
+
+// Calculate the moment of inertia for a solid polygon shape assuming its center of gravity is at its centroid.
+// The offset is added to each vertex.
+func MomentForPoly(m vect.Float, verts Vertices, offset vect.Vect) vect.Float {
+	sum1 := vect.Float(0)
+	sum2 := vect.Float(0)
+
+	for i := range verts {
+		v1 := vect.Add(verts[i], offset)
+		v2 := vect.Add(verts[(i+1)%len(verts)], offset)
+
+		a := vect.Cross(v2, v1)
+		b := vect.Dot(v1, v1) + vect.Dot(v1, v2) + vect.Dot(v2, v2)
+
+		sum1 += a * b
+		sum2 += a
+	}
+
+	return (m * sum1) / (6.0 * sum2)
+}
+
+// Calculate the signed area of a polygon.
+// A clockwise winding gives positive area. This is probably backwards from what you expect, but matches the winding of the polygon shapes.
+func AreaForPoly(verts Vertices) vect.Float {
+	area := vect.Float(0)
+	for i := range verts {
+		area += vect.Cross(verts[i], verts[(i+1)%len(verts)])
+	}
+
+	return -area / 2
+}
+
+// Calculate the natural centroid of a polygon.
+func CentroidForPoly(verts Vertices) vect.Vect {
+	sum := vect.Float(0)
+	vsum := vect.Vector_Zero
+
+	for i := range verts {
+		v1 := verts[i]
+		v2 := verts[(i+1)%len(verts)]
+		cross := vect.Cross(v1, v2)
+
+		sum += cross
+		vsum = vect.Add(vsum, vect.Mult(vect.Add(v1, v2), cross))
+	}
+
+	return vect.Mult(vsum, 1/(3*sum))
+}
+
+// Calculate the moment of inertia for a solid box.
+func MomentForBox(m, width, height vect.Float) vect.Float {
+	return m * (width*width + height*height) / 12
+}
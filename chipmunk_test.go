@@ -0,0 +1,41 @@
+package chipmunk
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+func TestMassHelpers(t *testing.T) {
+	square := Vertices{{-1, -1}, {-1, 1}, {1, 1}, {1, -1}}
+	cases := []struct {
+		name      string
+		got, want vect.Float
+	}{
+		{"MomentForCircle solid", MomentForCircle(2, 0, 3, vect.Vector_Zero), 9},
+		{"MomentForCircle hollow", MomentForCircle(2, 1, 3, vect.Vector_Zero), 10},
+		{"MomentForCircle offset", MomentForCircle(2, 0, 3, vect.Vect{3, 4}), 59},
+		{"AreaForCircle", AreaForCircle(1, 3), 8 * math.Pi},
+		{"MomentForSegment", MomentForSegment(3, vect.Vect{-2, 0}, vect.Vect{2, 0}, 0), 4},
+		{"MomentForSegment offset", MomentForSegment(3, vect.Vect{0, 0}, vect.Vect{4, 0}, 0), 16},
+		// The segment is extended to a length of 6 with a radius of 1.
+		{"MomentForSegment radius", MomentForSegment(3, vect.Vect{-2, 0}, vect.Vect{2, 0}, 1), 10},
+		{"AreaForSegment", AreaForSegment(vect.Vect{-2, 0}, vect.Vect{2, 0}, 1), math.Pi + 8},
+		{"MomentForBox", MomentForBox(3, 2, 4), 5},
+		{"MomentForPoly", MomentForPoly(3, square, vect.Vector_Zero), MomentForBox(3, 2, 2)},
+		{"MomentForPoly offset", MomentForPoly(3, square, vect.Vect{1, 0}), MomentForBox(3, 2, 2) + 3},
+		{"AreaForPoly clockwise", AreaForPoly(square), 4},
+		{"AreaForPoly counter-clockwise", AreaForPoly(square.Reversed()), -4},
+	}
+
+	for _, c := range cases {
+		if !nearlyEqual(c.got, c.want) {
+			t.Errorf("%s is %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	if centroid := CentroidForPoly(Vertices{{0, 0}, {0, 3}, {3, 0}}); !nearlyEqual(centroid.X, 1) || !nearlyEqual(centroid.Y, 1) {
+		t.Errorf("CentroidForPoly is %v, want {1 1}", centroid)
+	}
+}
@@ -1,8 +1,11 @@
 package chipmunk
 
 import (
+	"encoding/json"
+
 	"github.com/vova616/chipmunk/transform"
 	"github.com/vova616/chipmunk/vect"
+	"math"
 )
 
 type CircleShape struct {
@@ -16,11 +19,11 @@ type CircleShape struct {
 }
 
 // Creates a new CircleShape with the given center and radius.
-func NewCircle(pos vect.Vect, radius float32) *Shape {
+func NewCircle(pos vect.Vect, radius vect.Float) *Shape {
 	shape := newShape()
 	circle := &CircleShape{
 		Position: pos,
-		Radius:   vect.Float(radius),
+		Radius:   radius,
 		Shape:    shape,
 	}
 	shape.ShapeClass = circle
@@ -32,8 +35,26 @@ func (circle *CircleShape) ShapeType() ShapeType {
 	return ShapeType_Circle
 }
 
-func (circle *CircleShape) Moment(mass float32) vect.Float {
-	return (vect.Float(mass) * (0.5 * (circle.Radius * circle.Radius))) + vect.LengthSqr(circle.Position)
+func (circle *CircleShape) Moment(mass vect.Float) vect.Float {
+	return MomentForCircle(mass, 0, circle.Radius, circle.Position)
+}
+
+func (circle *CircleShape) Area() vect.Float {
+	return AreaForCircle(0, circle.Radius)
+}
+
+func (circle *CircleShape) Centroid() vect.Vect {
+	return circle.Position
+}
+
+func (circle *CircleShape) centroidMoment(mass vect.Float) vect.Float {
+	return MomentForCircle(mass, 0, circle.Radius, vect.Vector_Zero)
+}
+
+// Sets the radius of the circle and updates the mass of its body.
+func (circle *CircleShape) SetRadius(radius vect.Float) {
+	circle.Radius = radius
+	circle.Shape.updateBodyMass()
 }
 
 // Recalculates the global center of the circle and the the bounding box.
@@ -62,3 +83,70 @@ func (circle *CircleShape) TestPoint(point vect.Vect) bool {
 
 	return vect.Dot(d, d) <= circle.Radius*circle.Radius
 }
+
+func (circle *CircleShape) segmentQuery(a, b vect.Vect, info *SegmentQueryInfo) {
+	circleSegmentQuery(circle.Shape, circle.Tc, circle.Radius, a, b, info)
+}
+
+func circleSegmentQuery(shape *Shape, center vect.Vect, r vect.Float, a, b vect.Vect, info *SegmentQueryInfo) {
+	// offset the line to be relative to the circle
+	a = vect.Sub(a, center)
+	b = vect.Sub(b, center)
+
+	qa := vect.Dot(a, a) - 2*vect.Dot(a, b) + vect.Dot(b, b)
+	qb := -2*vect.Dot(a, a) + 2*vect.Dot(a, b)
+	qc := vect.Dot(a, a) - r*r
+
+	det := qb*qb - 4*qa*qc
+
+	if det >= 0 {
+		t := (-qb - vect.Float(math.Sqrt(float64(det)))) / (2 * qa)
+		if 0 <= t && t <= 1 {
+			info.Shape = shape
+			info.T = t
+			info.Normal = vect.Normalize(vect.Add(a, vect.Mult(vect.Sub(b, a), t)))
+		}
+	}
+}
+
+func (circle *CircleShape) nearestPointQuery(p vect.Vect) NearestPointQueryInfo {
+	delta := vect.Sub(p, circle.Tc)
+	d := delta.Length()
+	r := circle.Radius
+
+	info := NearestPointQueryInfo{Distance: d - r}
+	if d > magicEpsilon {
+		info.Point = vect.Add(circle.Tc, vect.Mult(delta, r/d))
+		info.Gradient = vect.Mult(delta, 1/d)
+	} else {
+		// Use up for the gradient if the distance is very small.
+		info.Point = vect.Add(circle.Tc, vect.Vect{0, r})
+		info.Gradient = vect.Vect{0, 1}
+	}
+	return info
+}
+
+func (circle *CircleShape) marshalShape(shape *Shape) ([]byte, error) {
+	return json.Marshal(struct {
+		Position vect.Vect
+		Radius   vect.Float
+	}{circle.Position, circle.Radius})
+}
+
+func (circle *CircleShape) unmarshalShape(shape *Shape, data []byte) error {
+	circleData := struct {
+		Position vect.Vect
+		Radius   vect.Float
+	}{}
+
+	err := json.Unmarshal(data, &circleData)
+	if err != nil {
+		return err
+	}
+
+	circle.Position = circleData.Position
+	circle.Radius = circleData.Radius
+	circle.Shape = shape
+	shape.ShapeClass = circle
+	return nil
+}
@@ -18,7 +18,7 @@ var collisionHandlers = [numShapes][numShapes]collisionHandler{
 	},
 	ShapeType_Segment: [numShapes]collisionHandler{
 		ShapeType_Circle:  nil,
-		ShapeType_Segment: nil,
+		ShapeType_Segment: segment2segment,
 		ShapeType_Polygon: segment2polygon,
 		ShapeType_Box:     segment2box,
 	},
@@ -42,9 +42,18 @@ func collide(contacts []*Contact, sA, sB *Shape) int {
 	stB := sB.ShapeType()
 
 	if stA > stB {
-		log.Printf("sta: %v, stb: %v", stA, stB)
-		log.Printf("Error: shapes not ordered")
-		return 0
+		// Only the upper half of the table is filled, collide the shapes
+		// the other way around and flip the normals back.
+		handler := collisionHandlers[stB][stA]
+		if handler == nil {
+			return 0
+		}
+
+		num := handler(contacts, sB, sA)
+		for i := 0; i < num; i++ {
+			contacts[i].n = vect.Mult(contacts[i].n, -1)
+		}
+		return num
 	}
 
 	handler := collisionHandlers[stA][stB]
@@ -114,6 +123,20 @@ func segment2polygon(contacts []*Contact, sA, sB *Shape) int {
 	return seg2polyFunc(contacts, segment, poly)
 }
 
+func segment2segment(contacts []*Contact, sA, sB *Shape) int {
+	seg1, ok := sA.ShapeClass.(*SegmentShape)
+	if !ok {
+		log.Printf("Error: ShapeA not a SegmentShape!")
+		return 0
+	}
+	seg2, ok := sB.ShapeClass.(*SegmentShape)
+	if !ok {
+		log.Printf("Error: ShapeB not a SegmentShape!")
+		return 0
+	}
+	return seg2segFunc(contacts, seg1, seg2)
+}
+
 func polygon2polygon(contacts []*Contact, sA, sB *Shape) int {
 	poly1, ok := sA.ShapeClass.(*PolygonShape)
 	if !ok {
@@ -511,3 +534,147 @@ func seg2polyFunc(contacts []*Contact, seg *SegmentShape, poly *PolygonShape) in
 
 	return num
 }
+
+// Returns the point on the segment a, b closest to p and its fraction along the segment.
+func closestPointOnSegment(p, a, b vect.Vect) (vect.Vect, vect.Float) {
+	delta := vect.Sub(b, a)
+	lenSqr := delta.LengthSqr()
+	if lenSqr == 0 {
+		return a, 0
+	}
+	t := vect.FClamp(vect.Dot(delta, vect.Sub(p, a))/lenSqr, 0, 1)
+	return vect.Add(a, vect.Mult(delta, t)), t
+}
+
+// Returns false if n, pointing into seg, would push it into the segment chained at the hit endpoint.
+func segmentEndpointAccept(seg *SegmentShape, t vect.Float, n vect.Vect) bool {
+	return (t != 0 || vect.Dot(n, seg.A_tangent) >= 0) && (t != 1 || vect.Dot(n, seg.B_tangent) >= 0)
+}
+
+type segContact struct {
+	p1, p2 vect.Vect
+	n      vect.Vect
+	dist   vect.Float
+	hash   HashValue
+}
+
+func seg2segFunc(contacts []*Contact, seg1, seg2 *SegmentShape) int {
+	rsum := seg1.Radius + seg2.Radius
+
+	// The segments cross each other, separate them along the normal that needs the least correction.
+	d1a := vect.Cross(vect.Sub(seg1.Tb, seg1.Ta), vect.Sub(seg2.Ta, seg1.Ta))
+	d1b := vect.Cross(vect.Sub(seg1.Tb, seg1.Ta), vect.Sub(seg2.Tb, seg1.Ta))
+	d2a := vect.Cross(vect.Sub(seg2.Tb, seg2.Ta), vect.Sub(seg1.Ta, seg2.Ta))
+	d2b := vect.Cross(vect.Sub(seg2.Tb, seg2.Ta), vect.Sub(seg1.Tb, seg2.Ta))
+	if d1a*d1b < 0 && d2a*d2b < 0 {
+		pos := vect.Add(seg1.Ta, vect.Mult(vect.Sub(seg1.Tb, seg1.Ta), d2a/(d2a-d2b)))
+
+		n, dist := seg1.Tn, vect.Float(0)
+		{
+			da := vect.Dot(seg1.Tn, vect.Sub(seg2.Ta, seg1.Ta))
+			db := vect.Dot(seg1.Tn, vect.Sub(seg2.Tb, seg1.Ta))
+			dist = vect.FMin(da, db) - rsum
+			if max := vect.FMax(da, db); -max-rsum > dist {
+				n, dist = vect.Mult(seg1.Tn, -1), -max-rsum
+			}
+		}
+		{
+			da := vect.Dot(seg2.Tn, vect.Sub(seg1.Ta, seg2.Ta))
+			db := vect.Dot(seg2.Tn, vect.Sub(seg1.Tb, seg2.Ta))
+			if d := vect.FMin(da, db) - rsum; d > dist {
+				n, dist = vect.Mult(seg2.Tn, -1), d
+			}
+			if d := -vect.FMax(da, db) - rsum; d > dist {
+				n, dist = seg2.Tn, d
+			}
+		}
+
+		contacts[0].reset(pos, n, dist, hashPair(seg1.Shape.Hash(), 2))
+		return 1
+	}
+
+	// The closest points of two segments that don't cross always involve an endpoint,
+	// test the endpoints of each segment against the other one.
+	// Used when an endpoint lies exactly on the other segment.
+	fallback := seg1.Tn
+	if vect.Dot(fallback, vect.Sub(vect.Add(seg2.Ta, seg2.Tb), vect.Add(seg1.Ta, seg1.Tb))) < 0 {
+		fallback = vect.Mult(fallback, -1)
+	}
+
+	candidates := [4]segContact{}
+	numCandidates := 0
+	for i, e := range [2]vect.Vect{seg2.Ta, seg2.Tb} {
+		c, t := closestPointOnSegment(e, seg1.Ta, seg1.Tb)
+		candidates[numCandidates] = segContact{p1: c, p2: e, hash: hashPair(seg2.Shape.Hash(), HashValue(i))}
+		cand := &candidates[numCandidates]
+		if segmentContactNormal(cand, rsum, fallback) && segmentEndpointAccept(seg1, t, vect.Mult(cand.n, -1)) && segmentEndpointAccept(seg2, vect.Float(i), cand.n) {
+			numCandidates++
+		}
+	}
+	for i, e := range [2]vect.Vect{seg1.Ta, seg1.Tb} {
+		c, t := closestPointOnSegment(e, seg2.Ta, seg2.Tb)
+		candidates[numCandidates] = segContact{p1: e, p2: c, hash: hashPair(seg1.Shape.Hash(), HashValue(i))}
+		cand := &candidates[numCandidates]
+		if segmentContactNormal(cand, rsum, fallback) && segmentEndpointAccept(seg1, vect.Float(i), vect.Mult(cand.n, -1)) && segmentEndpointAccept(seg2, t, cand.n) {
+			numCandidates++
+		}
+	}
+
+	if numCandidates == 0 {
+		return 0
+	}
+
+	// The deepest point decides the normal.
+	best := 0
+	for i := 1; i < numCandidates; i++ {
+		if candidates[i].dist < candidates[best].dist {
+			best = i
+		}
+	}
+	first := candidates[best]
+
+	num := 0
+	segmentContactReset(nextContact(contacts, &num), first, seg1.Radius, rsum)
+
+	// When the segments lie along each other add the point farthest away from the first one.
+	second, secondDist := -1, vect.Float(0)
+	for i := 0; i < numCandidates; i++ {
+		cand := candidates[i]
+		if i == best || vect.Dot(cand.n, first.n) < 0.9 {
+			continue
+		}
+		if d := vect.DistSqr(cand.p1, first.p1); d > secondDist {
+			second, secondDist = i, d
+		}
+	}
+	if second != -1 && secondDist > 1e-6 {
+		segmentContactReset(nextContact(contacts, &num), candidates[second], seg1.Radius, rsum)
+	}
+
+	return num
+}
+
+// Computes the normal and distance of a candidate, returns false if the points are too far apart.
+func segmentContactNormal(cand *segContact, rsum vect.Float, fallback vect.Vect) bool {
+	delta := vect.Sub(cand.p2, cand.p1)
+	distSqr := delta.LengthSqr()
+	if distSqr >= rsum*rsum {
+		return false
+	}
+
+	dist := vect.Float(math.Sqrt(float64(distSqr)))
+	if dist == 0 {
+		cand.n = fallback
+		cand.dist = -rsum
+		return true
+	}
+
+	cand.n = vect.Mult(delta, 1/dist)
+	cand.dist = dist - rsum
+	return true
+}
+
+func segmentContactReset(con *Contact, cand segContact, r1, rsum vect.Float) {
+	pos := vect.Add(cand.p1, vect.Mult(cand.n, r1+cand.dist*0.5))
+	con.reset(pos, cand.n, cand.dist, cand.hash)
+}
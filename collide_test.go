@@ -0,0 +1,105 @@
+package chipmunk
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Returns a copy of the contacts found between a and b.
+func collideShapes(a, b *Shape) []Contact {
+	buffer := make([]*Contact, MaxPoints)
+	for i := range buffer {
+		buffer[i] = &Contact{}
+	}
+
+	num := collide(buffer, a, b)
+	contacts := make([]Contact, num)
+	for i := range contacts {
+		contacts[i] = *buffer[i]
+	}
+	return contacts
+}
+
+func staticSegment(a, b vect.Vect, r vect.Float) *Shape {
+	return placeShape(NewSegment(a, b, r), vect.Vector_Zero, 0)
+}
+
+type contactCase struct {
+	name     string
+	a, b     *Shape
+	points   []vect.Vect
+	normal   vect.Vect
+	distance vect.Float
+}
+
+// Checks the contacts of the case and that colliding the shapes the other way around gives the same contacts with flipped normals.
+func checkContacts(t *testing.T, c contactCase) {
+	for _, swapped := range []bool{false, true} {
+		a, b, normal := c.a, c.b, c.normal
+		name := c.name
+		if swapped {
+			a, b, normal = b, a, vect.Mult(normal, -1)
+			name += " swapped"
+		}
+
+		contacts := collideShapes(a, b)
+		if len(contacts) != len(c.points) {
+			t.Errorf("%s: %d contacts, want %d", name, len(contacts), len(c.points))
+			continue
+		}
+		for _, want := range c.points {
+			found := false
+			for _, con := range contacts {
+				found = found || nearlyEqualVect(con.p, want)
+			}
+			if !found {
+				t.Errorf("%s: no contact at %v", name, want)
+			}
+		}
+		for _, con := range contacts {
+			if !nearlyEqualVect(con.n, normal) || !nearlyEqual(con.dist, c.distance) {
+				t.Errorf("%s: contact with normal %v and distance %v, want %v and %v", name, con.n, con.dist, normal, c.distance)
+			}
+		}
+	}
+}
+
+func TestSegmentToSegment(t *testing.T) {
+	horizontal := staticSegment(vect.Vect{-5, 0}, vect.Vect{5, 0}, 0)
+	thick := staticSegment(vect.Vect{-5, 0}, vect.Vect{5, 0}, 1)
+	capDir := vect.Normalize(vect.Vect{1, 0.5})
+	capDist := vect.Float(math.Sqrt(1.25)) - 2
+
+	cases := []contactCase{
+		// The vertical segment needs the least correction when pushed up.
+		{"crossing", horizontal, staticSegment(vect.Vect{0, -1}, vect.Vect{0, 3}, 0),
+			[]vect.Vect{{0, 0}}, vect.Vect{0, 1}, -1},
+		{"parallel overlap", thick, staticSegment(vect.Vect{0, 1.5}, vect.Vect{10, 1.5}, 1),
+			[]vect.Vect{{0, 0.75}, {5, 0.75}}, vect.Vect{0, 1}, -0.5},
+		{"contained", thick, staticSegment(vect.Vect{-2, -1}, vect.Vect{2, -1}, 0.5),
+			[]vect.Vect{{-2, -0.75}, {2, -0.75}}, vect.Vect{0, -1}, -0.5},
+		{"endpoint caps", thick, staticSegment(vect.Vect{6, 0.5}, vect.Vect{10, 0.5}, 1),
+			[]vect.Vect{vect.Add(vect.Vect{5, 0}, vect.Mult(capDir, 1+capDist/2))}, capDir, capDist},
+		{"endpoint on the side", thick, staticSegment(vect.Vect{0, 0.5}, vect.Vect{0, 10}, 0),
+			[]vect.Vect{{0, 0.75}}, vect.Vect{0, 1}, -0.5},
+		{"parallel apart", thick, staticSegment(vect.Vect{-5, 2.5}, vect.Vect{5, 2.5}, 1),
+			nil, vect.Vect{}, 0},
+		{"caps apart", thick, staticSegment(vect.Vect{7, 0}, vect.Vect{10, 0}, 1),
+			nil, vect.Vect{}, 0},
+	}
+	for _, c := range cases {
+		checkContacts(t, c)
+	}
+}
+
+// Shapes of different types are collided in the order of the table and their normals flipped.
+func TestCollideOrder(t *testing.T) {
+	thick := staticSegment(vect.Vect{-5, 0}, vect.Vect{5, 0}, 1)
+	circle := placeShape(NewCircle(vect.Vector_Zero, 1), vect.Vect{0, 1.5}, 0)
+	box := placeShape(NewBox(vect.Vector_Zero, 2, 2), vect.Vect{0, 0}, 0)
+
+	checkContacts(t, contactCase{"segment and circle", thick, circle, []vect.Vect{{0, 0.75}}, vect.Vect{0, 1}, -0.5})
+	checkContacts(t, contactCase{"circle and box", circle, box, []vect.Vect{{0, 0.75}}, vect.Vect{0, -1}, -0.5})
+}
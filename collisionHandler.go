@@ -0,0 +1,168 @@
+package chipmunk
+
+// Collision type of a shape used when picking collision handlers.
+type CollisionType uint
+
+// Collision begin event callback.
+// Returning false from a begin callback causes the collision to be ignored until
+// the the separate callback is called when the objects stop colliding.
+type CollisionBeginFunc func(arb *Arbiter, space *Space) bool
+
+// Collision pre-solve event callback.
+// Returning false from a pre-step callback causes the collision to be ignored until the next step.
+type CollisionPreSolveFunc func(arb *Arbiter, space *Space) bool
+
+// Collision post-solve event callback.
+type CollisionPostSolveFunc func(arb *Arbiter, space *Space)
+
+// Collision separate event callback.
+type CollisionSeparateFunc func(arb *Arbiter, space *Space)
+
+// Handler for collisions between shapes of the given collision types.
+// Any of the functions may be nil, a pair handler without a function
+// falls back to the wildcard handlers registered for TypeA and TypeB.
+type CollisionHandler struct {
+	TypeA, TypeB CollisionType
+
+	BeginFunc     CollisionBeginFunc
+	PreSolveFunc  CollisionPreSolveFunc
+	PostSolveFunc CollisionPostSolveFunc
+	SeparateFunc  CollisionSeparateFunc
+
+	UserData interface{}
+}
+
+type collisionTypePair struct {
+	a, b CollisionType
+}
+
+func newCollisionTypePair(a, b CollisionType) collisionTypePair {
+	if a > b {
+		return collisionTypePair{b, a}
+	}
+	return collisionTypePair{a, b}
+}
+
+// Returns the handler called when shapes with collision types a and b collide,
+// creating it if it doesn't exist yet. Shapes are passed to the handler in the a, b order.
+func (space *Space) AddCollisionHandler(a, b CollisionType) *CollisionHandler {
+	pair := newCollisionTypePair(a, b)
+	if handler, ok := space.collisionHandlers[pair]; ok {
+		return handler
+	}
+
+	handler := &CollisionHandler{TypeA: a, TypeB: b}
+	space.collisionHandlers[pair] = handler
+	return handler
+}
+
+func (space *Space) RemoveCollisionHandler(a, b CollisionType) {
+	delete(space.collisionHandlers, newCollisionTypePair(a, b))
+}
+
+// Returns the handler called for any collision involving a shape with the given collision type,
+// creating it if it doesn't exist yet. The shape with collision type t is always passed first.
+func (space *Space) AddWildcardHandler(t CollisionType) *CollisionHandler {
+	if handler, ok := space.wildcardHandlers[t]; ok {
+		return handler
+	}
+
+	handler := &CollisionHandler{TypeA: t}
+	space.wildcardHandlers[t] = handler
+	return handler
+}
+
+func (space *Space) RemoveWildcardHandler(t CollisionType) {
+	delete(space.wildcardHandlers, t)
+}
+
+func (space *Space) lookupHandlers(arb *Arbiter) {
+	a, b := arb.ShapeA.CollisionType, arb.ShapeB.CollisionType
+
+	arb.handler = space.collisionHandlers[newCollisionTypePair(a, b)]
+	arb.handlerSwapped = arb.handler != nil && arb.handler.TypeA != a
+	arb.handlerA = space.wildcardHandlers[a]
+	arb.handlerB = space.wildcardHandlers[b]
+}
+
+func (arb *Arbiter) callBegin(space *Space) bool {
+	defer arb.resetSwapped()
+
+	if h := arb.handler; h != nil && h.BeginFunc != nil {
+		arb.swapped = arb.handlerSwapped
+		return h.BeginFunc(arb, space)
+	}
+
+	result := true
+	if h := arb.handlerA; h != nil && h.BeginFunc != nil {
+		arb.swapped = false
+		result = h.BeginFunc(arb, space)
+	}
+	if h := arb.handlerB; h != nil && h.BeginFunc != nil {
+		arb.swapped = true
+		result = h.BeginFunc(arb, space) && result
+	}
+	return result
+}
+
+func (arb *Arbiter) callPreSolve(space *Space) bool {
+	defer arb.resetSwapped()
+
+	if h := arb.handler; h != nil && h.PreSolveFunc != nil {
+		arb.swapped = arb.handlerSwapped
+		return h.PreSolveFunc(arb, space)
+	}
+
+	result := true
+	if h := arb.handlerA; h != nil && h.PreSolveFunc != nil {
+		arb.swapped = false
+		result = h.PreSolveFunc(arb, space)
+	}
+	if h := arb.handlerB; h != nil && h.PreSolveFunc != nil {
+		arb.swapped = true
+		result = h.PreSolveFunc(arb, space) && result
+	}
+	return result
+}
+
+func (arb *Arbiter) callPostSolve(space *Space) {
+	defer arb.resetSwapped()
+
+	if h := arb.handler; h != nil && h.PostSolveFunc != nil {
+		arb.swapped = arb.handlerSwapped
+		h.PostSolveFunc(arb, space)
+		return
+	}
+
+	if h := arb.handlerA; h != nil && h.PostSolveFunc != nil {
+		arb.swapped = false
+		h.PostSolveFunc(arb, space)
+	}
+	if h := arb.handlerB; h != nil && h.PostSolveFunc != nil {
+		arb.swapped = true
+		h.PostSolveFunc(arb, space)
+	}
+}
+
+func (arb *Arbiter) callSeparate(space *Space) {
+	defer arb.resetSwapped()
+
+	if h := arb.handler; h != nil && h.SeparateFunc != nil {
+		arb.swapped = arb.handlerSwapped
+		h.SeparateFunc(arb, space)
+		return
+	}
+
+	if h := arb.handlerA; h != nil && h.SeparateFunc != nil {
+		arb.swapped = false
+		h.SeparateFunc(arb, space)
+	}
+	if h := arb.handlerB; h != nil && h.SeparateFunc != nil {
+		arb.swapped = true
+		h.SeparateFunc(arb, space)
+	}
+}
+
+func (arb *Arbiter) resetSwapped() {
+	arb.swapped = false
+}
@@ -0,0 +1,149 @@
+package chipmunk
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// A floor of collision type 1 and a box of collision type 2 touching it.
+func handlerScene() (*Space, *Shape, *Shape) {
+	space, floor := floorScene()
+	floor.Shapes[0].CollisionType = 1
+	box := addBox(space, vect.Vect{0, 4.9}, 10)
+	box.Shapes[0].CollisionType = 2
+	return space, floor.Shapes[0], box.Shapes[0]
+}
+
+// Records the callbacks of the handler as letters, b for begin, p for pre-solve, s for post-solve and e for separate.
+// The shapes passed to the callbacks must be first and second.
+func recordHandler(t *testing.T, handler *CollisionHandler, log *strings.Builder, first, second *Shape, accept bool) {
+	check := func(arb *Arbiter) {
+		a, b := arb.Shapes()
+		if a != first || b != second {
+			t.Errorf("handler of types %d and %d got the shapes in the wrong order", handler.TypeA, handler.TypeB)
+		}
+	}
+	handler.BeginFunc = func(arb *Arbiter, space *Space) bool {
+		check(arb)
+		log.WriteString("b")
+		return accept
+	}
+	handler.PreSolveFunc = func(arb *Arbiter, space *Space) bool {
+		check(arb)
+		log.WriteString("p")
+		return true
+	}
+	handler.PostSolveFunc = func(arb *Arbiter, space *Space) {
+		check(arb)
+		log.WriteString("s")
+	}
+	handler.SeparateFunc = func(arb *Arbiter, space *Space) {
+		check(arb)
+		log.WriteString("e")
+	}
+}
+
+func stepSpace(space *Space, steps int) {
+	for i := 0; i < steps; i++ {
+		space.Step(1.0 / 60)
+	}
+}
+
+func TestCollisionHandlerCallbacks(t *testing.T) {
+	space, floor, box := handlerScene()
+	var log strings.Builder
+	// The shapes are passed in the order of the types of the handler.
+	recordHandler(t, space.AddCollisionHandler(2, 1), &log, box, floor, true)
+
+	stepSpace(space, 3)
+	box.Body.SetPosition(vect.Vect{0, 100})
+	stepSpace(space, 2)
+
+	if got := log.String(); got != "bpspspse" {
+		t.Errorf("callbacks were %q, want %q", got, "bpspspse")
+	}
+
+	// Removed handlers are not called anymore.
+	log.Reset()
+	space.RemoveCollisionHandler(1, 2)
+	stepSpace(space, 120)
+	if log.Len() != 0 {
+		t.Errorf("removed handler was called: %q", log.String())
+	}
+}
+
+func TestCollisionHandlerBeginReject(t *testing.T) {
+	space, floor, box := handlerScene()
+	var log strings.Builder
+	recordHandler(t, space.AddCollisionHandler(1, 2), &log, floor, box, false)
+
+	// The box falls through the floor, the separate callback is still called once it leaves it.
+	stepSpace(space, 60)
+	if y := box.Body.Position().Y; y > -20 {
+		t.Errorf("rejected box is at %v, want it to fall through the floor", y)
+	}
+	if got := log.String(); got != "be" {
+		t.Errorf("callbacks were %q, want %q", got, "be")
+	}
+}
+
+func TestCollisionHandlerPreSolveReject(t *testing.T) {
+	space, _, box := handlerScene()
+	steps := 0
+	handler := space.AddCollisionHandler(1, 2)
+	handler.PreSolveFunc = func(arb *Arbiter, space *Space) bool {
+		steps++
+		return false
+	}
+	handler.PostSolveFunc = func(arb *Arbiter, space *Space) {
+		t.Errorf("post-solve called for a collision rejected by the pre-solve callback")
+	}
+
+	stepSpace(space, 60)
+	if y := box.Body.Position().Y; y > -20 {
+		t.Errorf("rejected box is at %v, want it to fall through the floor", y)
+	}
+	if steps < 2 {
+		t.Errorf("pre-solve called %d times, want it called every step of the collision", steps)
+	}
+}
+
+func TestWildcardHandlers(t *testing.T) {
+	space, floor, box := handlerScene()
+	var floorLog, boxLog strings.Builder
+	// Each wildcard handler gets its own shape first.
+	recordHandler(t, space.AddWildcardHandler(1), &floorLog, floor, box, true)
+	recordHandler(t, space.AddWildcardHandler(2), &boxLog, box, floor, true)
+
+	stepSpace(space, 2)
+	if floorLog.String() != "bpsps" || boxLog.String() != "bpsps" {
+		t.Errorf("wildcard callbacks were %q and %q, want %q", floorLog.String(), boxLog.String(), "bpsps")
+	}
+
+	// A pair handler replaces the wildcards for the callbacks it sets.
+	floorLog.Reset()
+	boxLog.Reset()
+	pairs := 0
+	space.AddCollisionHandler(1, 2).PostSolveFunc = func(arb *Arbiter, space *Space) {
+		pairs++
+	}
+	stepSpace(space, 2)
+	if pairs != 2 || floorLog.String() != "pp" || boxLog.String() != "pp" {
+		t.Errorf("pair handler called %d times and wildcards %q and %q, want 2, %q and %q",
+			pairs, floorLog.String(), boxLog.String(), "pp", "pp")
+	}
+
+	// Any wildcard rejecting the collision rejects it.
+	space, floor, box = handlerScene()
+	var log strings.Builder
+	recordHandler(t, space.AddWildcardHandler(1), &log, floor, box, true)
+	space.AddWildcardHandler(2).BeginFunc = func(arb *Arbiter, space *Space) bool {
+		return false
+	}
+	stepSpace(space, 60)
+	if y := box.Body.Position().Y; y > -20 {
+		t.Errorf("box rejected by a wildcard is at %v, want it to fall through the floor", y)
+	}
+}
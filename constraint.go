@@ -22,13 +22,13 @@ type Constraint interface {
 }
 
 type BasicConstraint struct {
-	BodyA, BodyB    *Body
+	BodyA, BodyB    *Body `json:"-"`
 	space           *Space
 	MaxForce        vect.Float
 	ErrorBias       vect.Float
 	MaxBias         vect.Float
-	CallbackHandler ConstraintCallback
-	UserData        Data
+	CallbackHandler ConstraintCallback `json:"-"`
+	UserData        Data               `json:"-"`
 }
 
 func NewConstraint(a, b *Body) BasicConstraint {
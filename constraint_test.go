@@ -0,0 +1,228 @@
+package chipmunk
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// A space with gravity and a static body at the origin to attach joints to.
+func jointScene() (*Space, *Body) {
+	space := NewSpace()
+	space.Gravity = vect.Vect{0, -100}
+
+	static := NewBodyStatic()
+	space.AddBody(static)
+	return space, static
+}
+
+// Adds a dynamic body without shapes at pos.
+func addJointBody(space *Space, pos vect.Vect) *Body {
+	body := NewBody(1, 10)
+	body.SetPosition(pos)
+	space.AddBody(body)
+	return body
+}
+
+// Returns the world position of an anchor given relative to the body's position.
+func anchorPosition(body *Body, anchor vect.Vect) vect.Vect {
+	return vect.Add(body.Position(), body.rotate(anchor))
+}
+
+// Steps the space and calls check after every step.
+func stepJoint(space *Space, steps int, check func(step int)) {
+	for i := 0; i < steps; i++ {
+		space.Step(1.0 / 60)
+		check(i)
+	}
+}
+
+func TestPinJoint(t *testing.T) {
+	space, static := jointScene()
+	space.SetDamping(0.5)
+	body := addJointBody(space, vect.Vect{10, 0})
+	anchor := vect.Vect{1, 0}
+	joint := NewPinJoint(static, body, vect.Vector_Zero, anchor)
+	space.AddConstraint(joint)
+	if !nearlyEqual(joint.Dist, 11) {
+		t.Fatalf("pin joint distance is %v, want 11", joint.Dist)
+	}
+
+	// The body swings like a pendulum, the joint only stretches a little while it is fast.
+	lowest := vect.Float(0)
+	stepJoint(space, 600, func(step int) {
+		p := anchorPosition(body, anchor)
+		if d := vect.Length(p); vect.FAbs(d-11) > 0.5 {
+			t.Fatalf("step %d: anchors are %v apart, want 11", step, d)
+		}
+		lowest = vect.FMin(lowest, p.Y)
+	})
+	if lowest > -10 {
+		t.Errorf("pendulum only swung down to %v", lowest)
+	}
+
+	// Once damped it hangs below the pin.
+	if p := anchorPosition(body, anchor); !nearlyEqual(vect.Length(p), 11) || p.Y > -10.9 {
+		t.Errorf("damped pendulum anchor is at %v, want it 11 below the pin", p)
+	}
+}
+
+func TestSlideJoint(t *testing.T) {
+	space, static := jointScene()
+	body := addJointBody(space, vect.Vect{0, -7})
+	space.AddConstraint(NewSlideJoint(static, body, vect.Vector_Zero, vect.Vector_Zero, 5, 10))
+
+	// The limits are only enforced once they are passed, so the body can
+	// overshoot them by about the distance it moves in a step.
+	check := func(step int) {
+		if d := vect.Length(body.Position()); d < 5-1 || d > 10+1 {
+			t.Fatalf("step %d: anchors are %v apart, want them between 5 and 10", step, d)
+		}
+	}
+
+	// The body falls to the maximum distance.
+	stepJoint(space, 60, check)
+	if d := vect.Length(body.Position()); !nearlyEqual(d, 10) {
+		t.Errorf("hanging body is %v away, want 10", d)
+	}
+
+	// Thrown up it stops at the minimum distance and falls back.
+	body.SetVelocity(0, 60)
+	closest := vect.Float(10)
+	stepJoint(space, 120, func(step int) {
+		check(step)
+		closest = vect.FMin(closest, vect.Length(body.Position()))
+	})
+	if closest > 5 {
+		t.Errorf("thrown body only got %v close, want it stopped at 5", closest)
+	}
+	if d := vect.Length(body.Position()); !nearlyEqual(d, 10) {
+		t.Errorf("body fell back to %v away, want 10", d)
+	}
+}
+
+func TestGrooveJoint(t *testing.T) {
+	space, static := jointScene()
+	static.SetPosition(vect.Vect{0, 5})
+	body := addJointBody(space, vect.Vect{0, 5})
+	body.SetVelocity(100, 0)
+	anchor := vect.Vect{0, 0}
+	space.AddConstraint(NewGrooveJoint(static, body, vect.Vect{-10, 0}, vect.Vect{10, 0}, anchor))
+
+	// The anchor slides along the groove against gravity and stops at its end.
+	farthest := vect.Float(0)
+	stepJoint(space, 120, func(step int) {
+		p := anchorPosition(body, anchor)
+		if vect.FAbs(p.Y-5) > 0.1 || p.X < -10.1 || p.X > 10.1 {
+			t.Fatalf("step %d: anchor at %v left the groove", step, p)
+		}
+		farthest = vect.FMax(farthest, p.X)
+	})
+	if farthest < 9.9 {
+		t.Errorf("anchor only slid to %v, want it at the end of the groove", farthest)
+	}
+}
+
+func TestRotaryLimitJoint(t *testing.T) {
+	space, static := jointScene()
+	body := addJointBody(space, vect.Vector_Zero)
+	space.AddConstraint(NewRotaryLimitJoint(static, body, -1, 1))
+
+	// Spun either way the body is stopped at the limit, overshooting it by at most a step.
+	for _, w := range []vect.Float{5, -5} {
+		body.SetAngularVelocity(w)
+		farthest := vect.Float(0)
+		stepJoint(space, 60, func(step int) {
+			a := body.Angle()
+			if a < -1-5.0/60 || a > 1+5.0/60 {
+				t.Fatalf("step %d: angle is %v, want it between -1 and 1", step, a)
+			}
+			farthest = vect.FMax(farthest, a*w/5)
+		})
+		if farthest < 0.99 {
+			t.Errorf("body spun at %v only turned to %v, want it to reach the limit", w, farthest)
+		}
+	}
+}
+
+func TestRatchetJoint(t *testing.T) {
+	space, static := jointScene()
+	body := addJointBody(space, vect.Vector_Zero)
+	joint := NewRatchetJoint(static, body, 0, math.Pi/2)
+	space.AddConstraint(joint)
+
+	// The ratchet can't be turned back from its starting angle.
+	body.SetAngularVelocity(-5)
+	stepJoint(space, 60, func(step int) {
+		if a := body.Angle(); a < -0.1 {
+			t.Fatalf("step %d: ratchet turned back to %v", step, a)
+		}
+	})
+
+	// It turns forward freely and then only back to the last notch passed.
+	body.SetAngularVelocity(1.2)
+	start := body.Angle()
+	stepJoint(space, 100, func(step int) {})
+	if a := body.Angle(); !nearlyEqual(a-start, 2) {
+		t.Errorf("ratchet turned forward by %v, want 2", a-start)
+	}
+
+	body.SetAngularVelocity(-5)
+	closest := body.Angle()
+	stepJoint(space, 60, func(step int) {
+		closest = vect.FMin(closest, body.Angle())
+	})
+	if closest < math.Pi/2-0.1 || closest > math.Pi/2+0.01 || !nearlyEqual(joint.Angle, math.Pi/2) {
+		t.Errorf("ratchet turned back to %v with its angle at %v, want both at the notch at %v", closest, joint.Angle, math.Pi/2)
+	}
+}
+
+func TestGearJoint(t *testing.T) {
+	space, _ := jointScene()
+	a := addJointBody(space, vect.Vector_Zero)
+	b := addJointBody(space, vect.Vect{10, 0})
+	space.AddConstraint(NewGearJoint(a, b, 0, 2))
+
+	// The second body turns twice as fast as the first one. The first step moves
+	// the bodies before the joint is solved, the error it leaves is then corrected.
+	a.SetAngularVelocity(3)
+	stepJoint(space, 120, func(step int) {
+		if d := b.Angle()/2 - a.Angle(); vect.FAbs(d) > 0.051 {
+			t.Fatalf("step %d: angles are %v and %v, want a ratio of 2", step, a.Angle(), b.Angle())
+		}
+	})
+	if d := b.Angle()/2 - a.Angle(); vect.FAbs(d) > 0.001 {
+		t.Errorf("angles are %v and %v, want a ratio of 2", a.Angle(), b.Angle())
+	}
+	if !nearlyEqual(b.AngularVelocity(), 2*a.AngularVelocity()) || a.AngularVelocity() <= 0 {
+		t.Errorf("angular velocities are %v and %v, want a ratio of 2", a.AngularVelocity(), b.AngularVelocity())
+	}
+}
+
+func TestDampedRotarySpring(t *testing.T) {
+	space, static := jointScene()
+	body := addJointBody(space, vect.Vector_Zero)
+	spring := NewDampedRotarySpring(static, body, 1, 100, 50)
+	space.AddConstraint(spring)
+
+	// The relative angle is the angle of the first body minus the second one's.
+	stepJoint(space, 600, func(step int) {})
+	if a := body.Angle(); vect.FAbs(a+1) > 0.01 {
+		t.Errorf("spring settled at %v, want -1", a)
+	}
+
+	// A custom torque function replaces the default spring.
+	calls := 0
+	spring.SpringTorqueFunc = func(s *DampedRotarySpring, relativeAngle vect.Float) vect.Float {
+		calls++
+		if relativeAngle != static.Angle()-body.Angle() {
+			t.Fatalf("torque function got a relative angle of %v, want %v", relativeAngle, static.Angle()-body.Angle())
+		}
+		return (relativeAngle - 0.5) * s.Stiffness
+	}
+	stepJoint(space, 600, func(step int) {})
+	if a := body.Angle(); vect.FAbs(a+0.5) > 0.01 || calls != 600 {
+		t.Errorf("custom spring called %d times settled at %v, want 600 and -0.5", calls, a)
+	}
+}
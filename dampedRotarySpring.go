@@ -0,0 +1,73 @@
+package chipmunk
+
+import (
+	"math"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+type DampedRotarySpring struct {
+	BasicConstraint
+
+	RestAngle        vect.Float
+	Stiffness        vect.Float
+	Damping          vect.Float
+	SpringTorqueFunc func(*DampedRotarySpring, vect.Float) vect.Float `json:"-"`
+
+	targetWRN vect.Float
+	wCoef     vect.Float
+
+	iSum vect.Float
+}
+
+func defaultSpringTorque(spring *DampedRotarySpring, relativeAngle vect.Float) vect.Float {
+	return (relativeAngle - spring.RestAngle) * spring.Stiffness
+}
+
+func NewDampedRotarySpring(a, b *Body, restAngle, stiffness, damping vect.Float) *DampedRotarySpring {
+	return &DampedRotarySpring{
+		BasicConstraint:  NewConstraint(a, b),
+		RestAngle:        restAngle,
+		Stiffness:        stiffness,
+		Damping:          damping,
+		SpringTorqueFunc: defaultSpringTorque,
+	}
+}
+
+func (spring *DampedRotarySpring) PreStep(dt vect.Float) {
+	a := spring.BodyA
+	b := spring.BodyB
+
+	moment := a.i_inv + b.i_inv
+	spring.iSum = 1.0 / moment
+
+	spring.wCoef = vect.Float(1.0 - math.Exp(float64(-spring.Damping*dt*moment)))
+	spring.targetWRN = 0.0
+
+	// apply spring torque
+	jSpring := spring.SpringTorqueFunc(spring, a.a-b.a) * dt
+	a.w -= jSpring * a.i_inv
+	b.w += jSpring * b.i_inv
+}
+
+func (spring *DampedRotarySpring) ApplyCachedImpulse(_ vect.Float) {}
+
+func (spring *DampedRotarySpring) ApplyImpulse() {
+	a := spring.BodyA
+	b := spring.BodyB
+
+	// compute relative velocity
+	wrn := a.w - b.w
+
+	// compute velocity loss from drag
+	wDamp := (spring.targetWRN - wrn) * spring.wCoef
+	spring.targetWRN = wrn + wDamp
+
+	jDamp := wDamp * spring.iSum
+	a.w += jDamp * a.i_inv
+	b.w -= jDamp * b.i_inv
+}
+
+func (spring *DampedRotarySpring) Impulse() vect.Float {
+	return 0
+}
@@ -14,7 +14,7 @@ type DampedSpring struct {
 	RestLength       vect.Float
 	Stiffness        vect.Float
 	Damping          vect.Float
-	SpringForceFunc  func(*DampedSpring, vect.Float) vect.Float
+	SpringForceFunc  func(*DampedSpring, vect.Float) vect.Float `json:"-"`
 
 	targetVRN vect.Float
 	vCoef     vect.Float
@@ -46,8 +46,8 @@ func (spring *DampedSpring) PreStep(dt vect.Float) {
 	a := spring.BodyA
 	b := spring.BodyB
 
-	spring.r1 = transform.RotateVect(spring.Anchor1, transform.Rotation{a.rot.X, a.rot.Y})
-	spring.r2 = transform.RotateVect(spring.Anchor2, transform.Rotation{a.rot.X, a.rot.Y})
+	spring.r1 = transform.RotateVect(vect.Sub(spring.Anchor1, a.cog), transform.Rotation{a.rot.X, a.rot.Y})
+	spring.r2 = transform.RotateVect(vect.Sub(spring.Anchor2, b.cog), transform.Rotation{a.rot.X, a.rot.Y})
 
 	delta := vect.Sub(vect.Add(b.p, spring.r2), vect.Add(a.p, spring.r1))
 	dist := vect.Length(delta)
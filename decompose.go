@@ -0,0 +1,421 @@
+package chipmunk
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Splits the simple polygon into triangles winded clockwise with ear clipping.
+// The polygon can be winded either way. The holes must be simple polygons inside it that don't touch each other.
+func (verts Vertices) Triangulate(holes ...Vertices) ([]Vertices, error) {
+	outline, err := decompositionOutline(verts, holes)
+	if err != nil {
+		return nil, err
+	}
+
+	var triangles []Vertices
+	for len(outline) > 3 {
+		clipped := false
+		for i := range outline {
+			a := outline[(i+len(outline)-1)%len(outline)]
+			b := outline[i]
+			c := outline[(i+1)%len(outline)]
+
+			cross := vect.Cross(vect.Sub(b, a), vect.Sub(c, b))
+			if cross == 0 && vect.Dot(vect.Sub(b, a), vect.Sub(c, b)) > 0 {
+				// Drop the vertices in the middle of a straight edge, they don't make a triangle.
+				outline = append(outline[:i], outline[i+1:]...)
+				clipped = true
+				break
+			}
+
+			if cross < 0 && outline.isEar(a, b, c) {
+				triangles = append(triangles, Vertices{a, b, c})
+				outline = append(outline[:i], outline[i+1:]...)
+				clipped = true
+				break
+			}
+		}
+
+		if !clipped {
+			return nil, errors.New("chipmunk: polygon is not simple, no ear left to clip")
+		}
+	}
+
+	if len(outline) == 3 && AreaForPoly(outline) > 0 {
+		triangles = append(triangles, outline)
+	}
+	return triangles, nil
+}
+
+// Splits the simple polygon into convex polygons winded clockwise.
+// The triangles of Triangulate are merged with the Hertel-Mehlhorn algorithm, giving at most
+// 4 times the minimal number of convex polygons.
+func (verts Vertices) ConvexDecomposition(holes ...Vertices) ([]Vertices, error) {
+	polys, err := verts.Triangulate(holes...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the diagonals between the polygons while the merged polygon stays convex.
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(polys) && !merged; i++ {
+			for j := i + 1; j < len(polys); j++ {
+				poly, ok := mergeConvex(polys[i], polys[j])
+				if !ok {
+					continue
+				}
+
+				last := len(polys) - 1
+				polys[i] = poly
+				polys[j], polys = polys[last], polys[:last]
+				merged = true
+				break
+			}
+		}
+	}
+
+	for i, poly := range polys {
+		polys[i] = poly.withoutCollinear()
+	}
+	return polys, nil
+}
+
+// Creates a PolygonShape with the given density for each convex polygon of the decomposition of the
+// simple polygon, offset by offset, and adds them to the body.
+// The mass of a body with automatic mass is the density times the area of the polygon.
+// The shapes still need to be added to the space if the body already is in one.
+func (body *Body) AddConcavePolygon(verts Vertices, holes []Vertices, offset vect.Vect, density vect.Float) ([]*Shape, error) {
+	polys, err := verts.ConvexDecomposition(holes...)
+	if err != nil {
+		return nil, err
+	}
+
+	shapes := make([]*Shape, 0, len(polys))
+	for _, poly := range polys {
+		shape := NewPolygon(poly, offset)
+		shape.SetDensity(density)
+		body.AddShape(shape)
+		shapes = append(shapes, shape)
+	}
+	return shapes, nil
+}
+
+// Returns the clockwise outline of the polygon with the holes joined to it by bridges,
+// the vertices at both ends of a bridge appear twice.
+func decompositionOutline(verts Vertices, holes []Vertices) (Vertices, error) {
+	outline := verts.withoutDuplicates()
+	if len(outline) < 3 {
+		return nil, fmt.Errorf("chipmunk: a polygon needs at least 3 vertices, got %d", len(outline))
+	}
+	if AreaForPoly(outline) == 0 {
+		return nil, errors.New("chipmunk: polygon vertices have no area")
+	}
+	if !outline.IsClockwise() {
+		outline = outline.Reversed()
+	}
+
+	// The holes are winded the other way so the outline goes around them.
+	cleanHoles := make([]Vertices, 0, len(holes))
+	for _, hole := range holes {
+		hole = hole.withoutDuplicates()
+		if len(hole) < 3 || AreaForPoly(hole) == 0 {
+			return nil, errors.New("chipmunk: polygon hole has no area")
+		}
+		if hole.IsClockwise() {
+			hole = hole.Reversed()
+		}
+		cleanHoles = append(cleanHoles, hole)
+	}
+
+	if err := checkSimple(append([]Vertices{outline}, cleanHoles...)); err != nil {
+		return nil, err
+	}
+	for i, hole := range cleanHoles {
+		if !outline.surrounds(hole[0]) {
+			return nil, errors.New("chipmunk: polygon hole is not inside the polygon")
+		}
+		for j, other := range cleanHoles {
+			if i != j && other.surrounds(hole[0]) {
+				return nil, errors.New("chipmunk: polygon hole is inside another hole")
+			}
+		}
+	}
+
+	// Join the holes from right to left, so the bridges of the holes joined later can't cross them.
+	for len(cleanHoles) > 0 {
+		right := 0
+		for i, hole := range cleanHoles {
+			if hole[hole.rightmost()].X > cleanHoles[right][cleanHoles[right].rightmost()].X {
+				right = i
+			}
+		}
+
+		var err error
+		outline, err = outline.joinHole(cleanHoles[right])
+		if err != nil {
+			return nil, err
+		}
+
+		last := len(cleanHoles) - 1
+		cleanHoles[right], cleanHoles = cleanHoles[last], cleanHoles[:last]
+	}
+
+	return outline, nil
+}
+
+// Returns the outline with the hole joined to it by a bridge from the rightmost vertex of the hole
+// to a visible vertex of the outline.
+// Uses the hole elimination of David Eberly's "Triangulation by Ear Clipping".
+func (verts Vertices) joinHole(hole Vertices) (Vertices, error) {
+	m := hole.rightmost()
+	mp := hole[m]
+
+	// Find the closest edge hit by the ray from the vertex towards +x.
+	hit := -1
+	hitX := Inf
+	for i := range verts {
+		a, b := verts[i], verts[(i+1)%len(verts)]
+		if (a.Y > mp.Y) == (b.Y > mp.Y) && a.Y != mp.Y && b.Y != mp.Y {
+			continue
+		}
+
+		var x vect.Float
+		if a.Y == b.Y {
+			x = vect.FMin(a.X, b.X)
+		} else {
+			x = a.X + (mp.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y)
+		}
+
+		if x >= mp.X && x < hitX {
+			hitX = x
+			hit = i
+		}
+	}
+
+	if hit < 0 {
+		return nil, errors.New("chipmunk: polygon hole is not inside the polygon")
+	}
+
+	// The bridge goes to the end of the hit edge further along the ray, unless a vertex inside the
+	// triangle between the ray and that end blocks it. The blocking vertex closest to the ray is visible.
+	hitPoint := vect.Vect{hitX, mp.Y}
+	p := hit
+	if next := (hit + 1) % len(verts); verts[next] == hitPoint ||
+		(verts[hit] != hitPoint && verts[next].X > verts[hit].X) {
+		p = next
+	}
+
+	if verts[p] != hitPoint {
+		tri := Vertices{mp, verts[p], hitPoint}
+		if !tri.IsClockwise() {
+			tri = tri.Reversed()
+		}
+
+		best := verts[p]
+		for i, v := range verts {
+			if i == p || v.X <= mp.X || !tri.containsPoint(v) {
+				continue
+			}
+
+			// Compare the slopes of the directions from the hole vertex, then the distances.
+			slope := vect.FAbs(v.Y-mp.Y) / (v.X - mp.X)
+			bestSlope := vect.FAbs(best.Y-mp.Y) / (best.X - mp.X)
+			if slope < bestSlope || (slope == bestSlope && vect.DistSqr(v, mp) < vect.DistSqr(best, mp)) {
+				best = v
+				p = i
+			}
+		}
+	}
+
+	// A vertex at the end of a bridge appears twice, join the hole at the one facing it.
+	for i, v := range verts {
+		if v == verts[p] && verts.wedgeContains(i, mp) {
+			p = i
+			break
+		}
+	}
+
+	joined := make(Vertices, 0, len(verts)+len(hole)+2)
+	joined = append(joined, verts[:p+1]...)
+	joined = append(joined, hole[m:]...)
+	joined = append(joined, hole[:m+1]...)
+	joined = append(joined, verts[p:]...)
+	return joined, nil
+}
+
+// Returns an error if an edge of the polygons crosses or touches another edge, other than the next edge of the
+// same polygon at their shared vertex.
+func checkSimple(polys []Vertices) error {
+	type edge struct {
+		a, b        vect.Vect
+		poly, index int
+	}
+
+	var edges []edge
+	for p, poly := range polys {
+		for i := range poly {
+			edges = append(edges, edge{poly[i], poly[(i+1)%len(poly)], p, i})
+		}
+	}
+
+	for i, e := range edges {
+		for _, f := range edges[i+1:] {
+			n := len(polys[e.poly])
+			if e.poly == f.poly && (f.index == e.index+1 || (e.index == 0 && f.index == n-1)) {
+				// Neighbouring edges only share a vertex, unless the polygon turns back on itself.
+				ab, cd := vect.Sub(e.b, e.a), vect.Sub(f.b, f.a)
+				if vect.Cross(ab, cd) == 0 && vect.Dot(ab, cd) < 0 {
+					return errors.New("chipmunk: polygon is not simple, it turns back on itself")
+				}
+				continue
+			}
+
+			if segmentsIntersect(e.a, e.b, f.a, f.b) {
+				if e.poly != f.poly {
+					return errors.New("chipmunk: polygon hole crosses the polygon or another hole")
+				}
+				return errors.New("chipmunk: polygon is not simple, its edges cross")
+			}
+		}
+	}
+	return nil
+}
+
+// Returns true if the segments ab and cd cross or touch.
+func segmentsIntersect(a, b, c, d vect.Vect) bool {
+	d1 := vect.Cross(vect.Sub(d, c), vect.Sub(a, c))
+	d2 := vect.Cross(vect.Sub(d, c), vect.Sub(b, c))
+	d3 := vect.Cross(vect.Sub(b, a), vect.Sub(c, a))
+	d4 := vect.Cross(vect.Sub(b, a), vect.Sub(d, a))
+
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+	return (d1 == 0 && inBox(c, d, a)) || (d2 == 0 && inBox(c, d, b)) ||
+		(d3 == 0 && inBox(a, b, c)) || (d4 == 0 && inBox(a, b, d))
+}
+
+// Returns true if p is inside the bounding box of the segment ab.
+func inBox(a, b, p vect.Vect) bool {
+	return p.X >= vect.FMin(a.X, b.X) && p.X <= vect.FMax(a.X, b.X) &&
+		p.Y >= vect.FMin(a.Y, b.Y) && p.Y <= vect.FMax(a.Y, b.Y)
+}
+
+// Returns true if the point is inside the simple polygon, using the even-odd rule.
+func (verts Vertices) surrounds(point vect.Vect) bool {
+	inside := false
+	for i := range verts {
+		a, b := verts[i], verts[(i+1)%len(verts)]
+		if (a.Y > point.Y) != (b.Y > point.Y) && point.X < a.X+(point.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Returns true if no other vertex of the clockwise outline is inside the triangle abc.
+func (verts Vertices) isEar(a, b, c vect.Vect) bool {
+	tri := Vertices{a, b, c}
+	for _, v := range verts {
+		// The vertices at the ends of a bridge appear twice.
+		if v == a || v == b || v == c {
+			continue
+		}
+		if tri.containsPoint(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the point is inside the corner of the clockwise outline at vertex i.
+func (verts Vertices) wedgeContains(i int, point vect.Vect) bool {
+	prev := verts[(i+len(verts)-1)%len(verts)]
+	v := verts[i]
+	next := verts[(i+1)%len(verts)]
+
+	rightOfPrev := vect.Cross(vect.Sub(v, prev), vect.Sub(point, prev)) < 0
+	rightOfNext := vect.Cross(vect.Sub(next, v), vect.Sub(point, v)) < 0
+	if vect.Cross(vect.Sub(v, prev), vect.Sub(next, v)) <= 0 {
+		return rightOfPrev && rightOfNext
+	}
+	return rightOfPrev || rightOfNext
+}
+
+// Returns true if the point is inside or on the clockwise convex polygon.
+func (verts Vertices) containsPoint(point vect.Vect) bool {
+	for i := range verts {
+		a, b := verts[i], verts[(i+1)%len(verts)]
+		if vect.Cross(vect.Sub(b, a), vect.Sub(point, a)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the index of the vertex with the largest x.
+func (verts Vertices) rightmost() int {
+	right := 0
+	for i, v := range verts {
+		if v.X > verts[right].X {
+			right = i
+		}
+	}
+	return right
+}
+
+// Returns the vertices without the consecutive duplicates.
+func (verts Vertices) withoutDuplicates() Vertices {
+	clean := make(Vertices, 0, len(verts))
+	for i, v := range verts {
+		if v != verts[(i+1)%len(verts)] {
+			clean = append(clean, v)
+		}
+	}
+	return clean
+}
+
+// Returns the vertices without the ones in the middle of a straight edge.
+func (verts Vertices) withoutCollinear() Vertices {
+	clean := make(Vertices, 0, len(verts))
+	for i, v := range verts {
+		prev := verts[(i+len(verts)-1)%len(verts)]
+		next := verts[(i+1)%len(verts)]
+		if vect.Cross(vect.Sub(v, prev), vect.Sub(next, v)) != 0 {
+			clean = append(clean, v)
+		}
+	}
+	return clean
+}
+
+// Merges two clockwise convex polygons sharing an edge, returns false if they don't share one
+// or the merged polygon is not convex.
+func mergeConvex(p, q Vertices) (Vertices, bool) {
+	for i := range p {
+		a, b := p[i], p[(i+1)%len(p)]
+		for j := range q {
+			if q[j] != b || q[(j+1)%len(q)] != a {
+				continue
+			}
+
+			// Walk p from b around to a, then q from after a around to before b.
+			merged := make(Vertices, 0, len(p)+len(q)-2)
+			for k := 1; k <= len(p); k++ {
+				merged = append(merged, p[(i+k)%len(p)])
+			}
+			for k := 2; k < len(q); k++ {
+				merged = append(merged, q[(j+k)%len(q)])
+			}
+
+			if !merged.ValidatePolygon() {
+				return nil, false
+			}
+			return merged, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,127 @@
+package chipmunk
+
+import (
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+var (
+	squareVerts = Vertices{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+	lShape      = Vertices{{0, 0}, {0, 10}, {2, 10}, {2, 2}, {10, 2}, {10, 0}}
+)
+
+func nearlyEqual(a, b vect.Float) bool {
+	return vect.FAbs(a-b) <= 1e-3*vect.FMax(1, vect.FAbs(b))
+}
+
+// Decomposes the polygon and checks that the pieces are convex, winded clockwise and cover the area of the polygon.
+func checkDecomposition(t *testing.T, name string, verts Vertices, holes ...Vertices) []Vertices {
+	want := vect.FAbs(AreaForPoly(verts))
+	for _, hole := range holes {
+		want -= vect.FAbs(AreaForPoly(hole))
+	}
+
+	triangles, err := verts.Triangulate(holes...)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	area := vect.Float(0)
+	for _, triangle := range triangles {
+		if len(triangle) != 3 || AreaForPoly(triangle) <= 0 {
+			t.Fatalf("%s: invalid triangle %v", name, triangle)
+		}
+		area += AreaForPoly(triangle)
+	}
+	if !nearlyEqual(area, want) {
+		t.Errorf("%s: triangles cover an area of %v, want %v", name, area, want)
+	}
+
+	polys, err := verts.ConvexDecomposition(holes...)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	area = 0
+	for _, poly := range polys {
+		if len(poly) < 3 || AreaForPoly(poly) <= 0 || !poly.ValidatePolygon() {
+			t.Fatalf("%s: invalid convex polygon %v", name, poly)
+		}
+		area += AreaForPoly(poly)
+	}
+	if !nearlyEqual(area, want) {
+		t.Errorf("%s: convex polygons cover an area of %v, want %v", name, area, want)
+	}
+	return polys
+}
+
+func TestConvexDecomposition(t *testing.T) {
+	if polys := checkDecomposition(t, "square", squareVerts); len(polys) != 1 {
+		t.Errorf("square: %d convex polygons, want 1", len(polys))
+	}
+	if polys := checkDecomposition(t, "L", lShape); len(polys) != 2 {
+		t.Errorf("L: %d convex polygons, want 2", len(polys))
+	}
+	checkDecomposition(t, "counter-clockwise L", lShape.Reversed())
+	checkDecomposition(t, "square with a hole", squareVerts, Vertices{{3, 3}, {7, 3}, {7, 7}, {3, 7}})
+	checkDecomposition(t, "square with two holes", squareVerts,
+		Vertices{{1, 1}, {4, 1}, {4, 4}, {1, 4}}, Vertices{{6, 6}, {9, 6}, {9, 9}, {6, 9}})
+	checkDecomposition(t, "square with two aligned holes", squareVerts,
+		Vertices{{1, 4}, {4, 4}, {4, 6}, {1, 6}}, Vertices{{6, 4}, {9, 4}, {9, 6}, {6, 6}})
+	checkDecomposition(t, "duplicate vertices", Vertices{{0, 0}, {0, 0}, {0, 10}, {2, 10}, {2, 2}, {10, 2}, {10, 0}, {10, 0}})
+}
+
+func TestConvexDecompositionInvalid(t *testing.T) {
+	hole := Vertices{{3, 3}, {7, 3}, {7, 7}, {3, 7}}
+	cases := []struct {
+		name  string
+		verts Vertices
+		holes []Vertices
+	}{
+		{"no vertices", nil, nil},
+		{"two vertices", Vertices{{0, 0}, {10, 0}}, nil},
+		{"same vertex", Vertices{{1, 1}, {1, 1}, {1, 1}}, nil},
+		{"collinear", Vertices{{0, 0}, {5, 5}, {10, 10}}, nil},
+		{"crossing edges", Vertices{{0, 0}, {10, 10}, {10, 0}, {0, 20}}, nil},
+		{"bow tie", Vertices{{0, 0}, {10, 10}, {10, 0}, {0, 10}}, nil},
+		{"touching itself", Vertices{{0, 0}, {10, 0}, {5, 5}, {10, 10}, {0, 10}, {5, 5}}, nil},
+		{"degenerate hole", squareVerts, []Vertices{{{3, 3}, {4, 4}, {5, 5}}}},
+		{"hole outside", squareVerts, []Vertices{{{20, 20}, {21, 20}, {21, 21}}}},
+		{"hole crossing the polygon", squareVerts, []Vertices{{{5, 5}, {15, 5}, {15, 8}, {5, 8}}}},
+		{"crossing holes", squareVerts, []Vertices{hole, {{5, 5}, {9, 5}, {9, 9}, {5, 9}}}},
+		{"hole in a hole", squareVerts, []Vertices{hole, {{4, 4}, {6, 4}, {6, 6}, {4, 6}}}},
+	}
+
+	for _, c := range cases {
+		if polys, err := c.verts.ConvexDecomposition(c.holes...); err == nil {
+			t.Errorf("%s: no error, got %v", c.name, polys)
+		}
+	}
+}
+
+func TestAddConcavePolygon(t *testing.T) {
+	body := NewBody(1, 1)
+	body.SetAutoMass(true)
+	shapes, err := body.AddConcavePolygon(lShape, nil, vect.Vect{1, 1}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shapes) != 2 || len(body.Shapes) != 2 {
+		t.Fatalf("%d shapes, want 2", len(shapes))
+	}
+
+	// The L is a 2x10 and an 8x2 rectangle, their centroids are (1, 5) and (6, 1).
+	if mass := body.Mass(); !nearlyEqual(mass, 2*36) {
+		t.Errorf("mass is %v, want 72", mass)
+	}
+	cog := vect.Vect{(20*1+16*6)/36.0 + 1, (20*5+16*1)/36.0 + 1}
+	if got := body.CenterOfGravity(); !nearlyEqual(got.X, cog.X) || !nearlyEqual(got.Y, cog.Y) {
+		t.Errorf("center of gravity is %v, want %v", got, cog)
+	}
+
+	if _, err := body.AddConcavePolygon(Vertices{{0, 0}, {10, 10}, {10, 0}, {0, 20}}, nil, vect.Vector_Zero, 1); err == nil {
+		t.Errorf("added a self-intersecting polygon")
+	}
+	if len(body.Shapes) != 2 {
+		t.Errorf("failed decomposition added shapes")
+	}
+}
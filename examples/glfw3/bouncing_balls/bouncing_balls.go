@@ -69,10 +69,10 @@ func draw() {
 
 func addBall() {
 	x := rand.Intn(350-115) + 115
-	ball := chipmunk.NewCircle(vect.Vector_Zero, float32(ballRadius))
+	ball := chipmunk.NewCircle(vect.Vector_Zero, vect.Float(ballRadius))
 	ball.SetElasticity(0.95)
 
-	body := chipmunk.NewBody(vect.Float(ballMass), ball.Moment(float32(ballMass)))
+	body := chipmunk.NewBody(vect.Float(ballMass), ball.Moment(vect.Float(ballMass)))
 	body.SetPosition(vect.Vect{vect.Float(x), 600.0})
 	body.SetAngle(vect.Float(rand.Float32() * 2 * math.Pi))
 
@@ -0,0 +1,69 @@
+package chipmunk
+
+import (
+	"github.com/vova616/chipmunk/vect"
+)
+
+// GearJoint keeps the angular velocity ratio of two bodies constant.
+type GearJoint struct {
+	BasicConstraint
+	Phase, Ratio vect.Float
+
+	ratio_inv vect.Float
+	iSum      vect.Float
+	bias      vect.Float
+	jAcc      vect.Float
+	jMax      vect.Float
+}
+
+func NewGearJoint(a, b *Body, phase, ratio vect.Float) *GearJoint {
+	return &GearJoint{
+		BasicConstraint: NewConstraint(a, b),
+		Phase:           phase,
+		Ratio:           ratio,
+	}
+}
+
+func (joint *GearJoint) PreStep(dt vect.Float) {
+	a, b := joint.BodyA, joint.BodyB
+
+	joint.ratio_inv = 1.0 / joint.Ratio
+
+	// calculate moment of inertia coefficient.
+	joint.iSum = 1.0 / (a.i_inv*joint.ratio_inv + joint.Ratio*b.i_inv)
+
+	// calculate bias velocity
+	joint.bias = vect.FClamp(-bias_coef(joint.ErrorBias, dt)*(b.a*joint.ratio_inv-a.a-joint.Phase)/dt, -joint.MaxBias, joint.MaxBias)
+
+	// compute max impulse
+	joint.jMax = joint.MaxForce * dt
+}
+
+func (joint *GearJoint) ApplyCachedImpulse(dt_coef vect.Float) {
+	a, b := joint.BodyA, joint.BodyB
+
+	j := joint.jAcc * dt_coef
+	a.w -= j * a.i_inv * joint.ratio_inv
+	b.w += j * b.i_inv
+}
+
+func (joint *GearJoint) ApplyImpulse() {
+	a, b := joint.BodyA, joint.BodyB
+
+	// compute relative rotational velocity
+	wr := b.w*joint.ratio_inv - a.w
+
+	// compute normal impulse
+	j := (joint.bias - wr) * joint.iSum
+	jOld := joint.jAcc
+	joint.jAcc = vect.FClamp(jOld+j, -joint.jMax, joint.jMax)
+	j = joint.jAcc - jOld
+
+	// apply impulse
+	a.w -= j * a.i_inv * joint.ratio_inv
+	b.w += j * b.i_inv
+}
+
+func (joint *GearJoint) Impulse() vect.Float {
+	return vect.FAbs(joint.jAcc)
+}
@@ -0,0 +1,106 @@
+package chipmunk
+
+import (
+	"github.com/vova616/chipmunk/transform"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// GrooveJoint keeps the anchor point of body B on the groove segment of body A.
+type GrooveJoint struct {
+	BasicConstraint
+	// The groove endpoints, relative to body A.
+	GrooveA, GrooveB vect.Vect
+	Anchor2          vect.Vect
+
+	grv_tn vect.Vect
+	clamp  vect.Float
+	r1, r2 vect.Vect
+	k1, k2 vect.Vect
+
+	jAcc    vect.Vect
+	jMaxLen vect.Float
+	bias    vect.Vect
+}
+
+func NewGrooveJoint(a, b *Body, grooveA, grooveB, anchor2 vect.Vect) *GrooveJoint {
+	return &GrooveJoint{
+		BasicConstraint: NewConstraint(a, b),
+		GrooveA:         grooveA,
+		GrooveB:         grooveB,
+		Anchor2:         anchor2,
+	}
+}
+
+func (this *GrooveJoint) PreStep(dt vect.Float) {
+	a, b := this.BodyA, this.BodyB
+	rotA := transform.Rotation{a.rot.X, a.rot.Y}
+
+	// calculate endpoints in worldspace
+	ta := vect.Add(a.p, transform.RotateVect(vect.Sub(this.GrooveA, a.cog), rotA))
+	tb := vect.Add(a.p, transform.RotateVect(vect.Sub(this.GrooveB, a.cog), rotA))
+
+	// calculate axis
+	n := transform.RotateVect(vect.Perp(vect.Normalize(vect.Sub(this.GrooveB, this.GrooveA))), rotA)
+	d := vect.Dot(ta, n)
+
+	this.grv_tn = n
+	this.r2 = transform.RotateVect(vect.Sub(this.Anchor2, b.cog), transform.Rotation{b.rot.X, b.rot.Y})
+
+	// calculate tangential distance along the axis of r2
+	td := vect.Cross(vect.Add(b.p, this.r2), n)
+	// calculate clamping factor and r1
+	if td <= vect.Cross(ta, n) {
+		this.clamp = 1
+		this.r1 = vect.Sub(ta, a.p)
+	} else if td >= vect.Cross(tb, n) {
+		this.clamp = -1
+		this.r1 = vect.Sub(tb, a.p)
+	} else {
+		this.clamp = 0
+		this.r1 = vect.Sub(vect.Add(vect.Mult(vect.Perp(n), -td), vect.Mult(n, d)), a.p)
+	}
+
+	// Calculate mass tensor
+	k_tensor(a, b, this.r1, this.r2, &this.k1, &this.k2)
+
+	// compute max impulse
+	this.jMaxLen = this.MaxForce * dt
+
+	// calculate bias velocity
+	delta := vect.Sub(vect.Add(b.p, this.r2), vect.Add(a.p, this.r1))
+	this.bias = vect.Clamp(vect.Mult(delta, -bias_coef(this.ErrorBias, dt)/dt), this.MaxBias)
+}
+
+func (this *GrooveJoint) ApplyCachedImpulse(dt_coef vect.Float) {
+	apply_impulses(this.BodyA, this.BodyB, this.r1, this.r2, vect.Mult(this.jAcc, dt_coef))
+}
+
+func (this *GrooveJoint) grooveConstrain(j vect.Vect) vect.Vect {
+	n := this.grv_tn
+	jClamp := j
+	if this.clamp*vect.Cross(j, n) <= 0 {
+		// project j onto the groove normal
+		jClamp = vect.Mult(n, vect.Dot(j, n)/vect.Dot(n, n))
+	}
+	return vect.Clamp(jClamp, this.jMaxLen)
+}
+
+func (this *GrooveJoint) ApplyImpulse() {
+	a, b := this.BodyA, this.BodyB
+	r1, r2 := this.r1, this.r2
+
+	// compute impulse
+	vr := relative_velocity(a, b, r1, r2)
+
+	j := mult_k(vect.Sub(this.bias, vr), this.k1, this.k2)
+	jOld := this.jAcc
+	this.jAcc = this.grooveConstrain(vect.Add(jOld, j))
+	j = vect.Sub(this.jAcc, jOld)
+
+	// apply impulse
+	apply_impulses(a, b, r1, r2, j)
+}
+
+func (this *GrooveJoint) Impulse() vect.Float {
+	return vect.Length(this.jAcc)
+}
@@ -0,0 +1,448 @@
+package chipmunk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Constructors used to decode the constraints by their type name.
+var constraintTypes = map[string]func() Constraint{
+	"PivotJoint":         func() Constraint { return &PivotJoint{} },
+	"PinJoint":           func() Constraint { return &PinJoint{} },
+	"SlideJoint":         func() Constraint { return &SlideJoint{} },
+	"GrooveJoint":        func() Constraint { return &GrooveJoint{} },
+	"DampedSpring":       func() Constraint { return &DampedSpring{SpringForceFunc: defaultSpringForce} },
+	"DampedRotarySpring": func() Constraint { return &DampedRotarySpring{SpringTorqueFunc: defaultSpringTorque} },
+	"RotaryLimitJoint":   func() Constraint { return &RotaryLimitJoint{} },
+	"RatchetJoint":       func() Constraint { return &RatchetJoint{} },
+	"GearJoint":          func() Constraint { return &GearJoint{} },
+	"SimpleMotor":        func() Constraint { return &SimpleMotor{} },
+}
+
+type shapeJSON struct {
+	Type            string
+	IsSensor        bool
+	Elasticity      vect.Float
+	Friction        vect.Float
+	SurfaceVelocity vect.Vect
+	Mass            vect.Float
+	Density         vect.Float
+	CollisionType   CollisionType
+	Group           Group
+	Layer           Layer
+	Data            json.RawMessage
+}
+
+type bodyJSON struct {
+	Type            BodyType
+	Mass            vect.Float
+	Moment          vect.Float
+	AutoMass        bool
+	CenterOfGravity vect.Vect
+	Position        vect.Vect
+	Velocity        vect.Vect
+	Force           vect.Vect
+	Angle           vect.Float
+	AngularVelocity vect.Float
+	Torque          vect.Float
+	IgnoreGravity   bool
+	Enabled         bool
+	Bullet          bool
+	Shapes          []shapeJSON
+}
+
+type constraintJSON struct {
+	Type string
+	// Indexes of the bodies in the Bodies list.
+	BodyA, BodyB int
+	Data         json.RawMessage
+}
+
+type spatialHashJSON struct {
+	CellSize vect.Float
+	Count    int
+}
+
+type bbTreeJSON struct {
+	Margin       vect.Float
+	VelocityCoef vect.Float
+}
+
+type spaceJSON struct {
+	Iterations           int
+	Gravity              vect.Vect
+	Damping              vect.Float
+	IdleSpeedThreshold   vect.Float
+	SleepTimeThreshold   vect.Float
+	CollisionSlop        vect.Float
+	CollisionBias        vect.Float
+	CollisionPersistence int64
+	// The spatial index of the active shapes, only one of them is set.
+	BBTree      *bbTreeJSON      `json:",omitempty"`
+	SpatialHash *spatialHashJSON `json:",omitempty"`
+	Sweep1D     bool             `json:",omitempty"`
+	Bodies      []bodyJSON
+	Constraints []constraintJSON
+}
+
+// Encodes the space settings, all the bodies (static, sleeping and active) with their shapes and all the constraints.
+// Callbacks and user data are not encoded.
+func (space *Space) MarshalJSON() ([]byte, error) {
+	spaceData := spaceJSON{
+		Iterations:           space.Iterations,
+		Gravity:              space.Gravity,
+		Damping:              space.damping,
+		IdleSpeedThreshold:   space.idleSpeedThreshold,
+		SleepTimeThreshold:   space.sleepTimeThreshold,
+		CollisionSlop:        space.collisionSlop,
+		CollisionBias:        space.collisionBias,
+		CollisionPersistence: space.collisionPersistence,
+	}
+
+	switch index := space.activeShapes.SpatialIndexClass.(type) {
+	case *BBTree:
+		spaceData.BBTree = &bbTreeJSON{index.Margin, index.VelocityCoef}
+	case *SpaceHash:
+		spaceData.SpatialHash = &spatialHashJSON{index.cellDim, index.numCells}
+	case *Sweep1D:
+		spaceData.Sweep1D = true
+	}
+
+	bodies, constraints := space.allBodies(), space.allConstraints()
+
+	indexes := make(map[*Body]int)
+	addBody := func(body *Body) {
+		if _, ok := indexes[body]; !ok {
+			indexes[body] = len(bodies)
+			bodies = append(bodies, body)
+		}
+	}
+	for i, body := range bodies {
+		indexes[body] = i
+	}
+	for _, constraint := range constraints {
+		con := constraint.Constraint()
+		addBody(con.BodyA)
+		addBody(con.BodyB)
+	}
+
+	for _, body := range bodies {
+		bodyData, err := marshalBody(body)
+		if err != nil {
+			return nil, err
+		}
+		spaceData.Bodies = append(spaceData.Bodies, bodyData)
+	}
+
+	for _, constraint := range constraints {
+		name := reflect.TypeOf(constraint).Elem().Name()
+		if _, ok := constraintTypes[name]; !ok {
+			return nil, fmt.Errorf("chipmunk: cannot encode constraint of type %s", name)
+		}
+
+		data, err := json.Marshal(constraint)
+		if err != nil {
+			return nil, err
+		}
+
+		con := constraint.Constraint()
+		spaceData.Constraints = append(spaceData.Constraints, constraintJSON{
+			Type:  name,
+			BodyA: indexes[con.BodyA],
+			BodyB: indexes[con.BodyB],
+			Data:  data,
+		})
+	}
+
+	return json.Marshal(&spaceData)
+}
+
+// Replaces the content of the space with the decoded space.
+// The workers and the collision handlers of the space are kept, and so are its spatial indexes if the data doesn't
+// choose them. The space is left unchanged if the data can't be decoded.
+func (space *Space) UnmarshalJSON(data []byte) error {
+	space.assertUnlocked()
+
+	spaceData := spaceJSON{}
+	err := json.Unmarshal(data, &spaceData)
+	if err != nil {
+		return err
+	}
+
+	bodies := make([]*Body, len(spaceData.Bodies))
+	for i, bodyData := range spaceData.Bodies {
+		body, err := unmarshalBody(&bodyData)
+		if err != nil {
+			return err
+		}
+		bodies[i] = body
+	}
+
+	constraints := make([]Constraint, len(spaceData.Constraints))
+	for i, conData := range spaceData.Constraints {
+		newConstraint, ok := constraintTypes[conData.Type]
+		if !ok {
+			return fmt.Errorf("chipmunk: unknown constraint type %s", conData.Type)
+		}
+		if conData.BodyA < 0 || conData.BodyA >= len(bodies) || conData.BodyB < 0 || conData.BodyB >= len(bodies) {
+			return errors.New("chipmunk: constraint body index out of range")
+		}
+
+		constraint := newConstraint()
+		err := json.Unmarshal(conData.Data, constraint)
+		if err != nil {
+			return err
+		}
+
+		con := constraint.Constraint()
+		con.BodyA = bodies[conData.BodyA]
+		con.BodyB = bodies[conData.BodyB]
+		constraints[i] = constraint
+	}
+
+	if space.activeShapes == nil {
+		// Decoding into a zero Space.
+		*space = *NewSpace()
+	}
+	space.clear()
+	space.Iterations = spaceData.Iterations
+	space.Gravity = spaceData.Gravity
+	space.damping = spaceData.Damping
+	space.idleSpeedThreshold = spaceData.IdleSpeedThreshold
+	space.sleepTimeThreshold = spaceData.SleepTimeThreshold
+	space.collisionSlop = spaceData.CollisionSlop
+	space.collisionBias = spaceData.CollisionBias
+	space.collisionPersistence = spaceData.CollisionPersistence
+	switch {
+	case spaceData.SpatialHash != nil:
+		space.UseSpatialHash(spaceData.SpatialHash.CellSize, spaceData.SpatialHash.Count)
+	case spaceData.Sweep1D:
+		space.UseSweep1D()
+	case spaceData.BBTree != nil:
+		if GetTree(space.activeShapes.SpatialIndexClass) == nil {
+			space.UseBBTree()
+		}
+		space.SetBBTreeExpansion(spaceData.BBTree.Margin, spaceData.BBTree.VelocityCoef)
+	}
+
+	for _, body := range bodies {
+		space.AddBody(body)
+	}
+	for _, constraint := range constraints {
+		space.AddConstraint(constraint)
+	}
+
+	return nil
+}
+
+// Removes all the bodies, shapes and constraints from the space, keeping its settings and spatial indexes.
+func (space *Space) clear() {
+	for _, constraint := range space.allConstraints() {
+		constraint.Constraint().space = nil
+	}
+	for _, body := range space.allBodies() {
+		for _, shape := range body.Shapes {
+			shape.space = nil
+		}
+		body.space = nil
+		body.arbiters = nil
+		body.constraints = nil
+		body.node = ComponentNode{}
+	}
+
+	for _, index := range []*SpatialIndex{space.activeShapes, space.staticShapes} {
+		var objs []Indexable
+		index.Each(func(node *Node) {
+			objs = append(objs, node.obj)
+		})
+		for _, obj := range objs {
+			index.Remove(obj)
+		}
+	}
+
+	space.Bodies = make([]*Body, 0)
+	space.sleepingComponents = make([]*Body, 0)
+	space.deleteBodies = make([]*Body, 0)
+	space.Constraints = make([]Constraint, 0)
+	space.cachedArbiters = make(map[HashPair]*Arbiter)
+	space.cachedArbitersOrder = nil
+	space.Arbiters = make([]*Arbiter, 0)
+	space.rousedBodies = nil
+	space.postStepCallbacks = nil
+	space.curr_dt = 0
+}
+
+// Returns the active, sleeping and static bodies of the space.
+// Static bodies are found through their shapes and are ordered by creation of their shapes.
+func (space *Space) allBodies() []*Body {
+	bodies := make([]*Body, 0, len(space.Bodies))
+	seen := make(map[*Body]bool)
+
+	for _, body := range space.Bodies {
+		seen[body] = true
+		bodies = append(bodies, body)
+	}
+
+	for _, root := range space.sleepingComponents {
+		for body := root; body != nil; body = body.node.Next {
+			seen[body] = true
+			bodies = append(bodies, body)
+		}
+	}
+
+	shapes := make([]*Shape, 0, space.staticShapes.Count())
+	space.staticShapes.Each(func(node *Node) {
+		shapes = append(shapes, node.obj.Shape())
+	})
+	sort.Sort(shapesByHash(shapes))
+
+	for _, shape := range shapes {
+		if body := shape.Body; !seen[body] {
+			seen[body] = true
+			bodies = append(bodies, body)
+		}
+	}
+
+	return bodies
+}
+
+// Returns the active constraints and the constraints of the sleeping bodies.
+func (space *Space) allConstraints() []Constraint {
+	constraints := make([]Constraint, 0, len(space.Constraints))
+	seen := make(map[Constraint]bool)
+
+	for _, constraint := range space.Constraints {
+		seen[constraint] = true
+		constraints = append(constraints, constraint)
+	}
+
+	for _, root := range space.sleepingComponents {
+		for body := root; body != nil; body = body.node.Next {
+			for _, constraint := range body.constraints {
+				if !seen[constraint] {
+					seen[constraint] = true
+					constraints = append(constraints, constraint)
+				}
+			}
+		}
+	}
+
+	return constraints
+}
+
+type shapesByHash []*Shape
+
+func (s shapesByHash) Len() int           { return len(s) }
+func (s shapesByHash) Less(i, j int) bool { return s[i].Hash() < s[j].Hash() }
+func (s shapesByHash) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func marshalBody(body *Body) (bodyJSON, error) {
+	bodyData := bodyJSON{
+		Type:            body.Type(),
+		Mass:            body.m,
+		Moment:          body.i,
+		AutoMass:        body.autoMass,
+		CenterOfGravity: body.cog,
+		Position:        body.p,
+		Velocity:        body.v,
+		Force:           body.f,
+		Angle:           body.a,
+		AngularVelocity: body.w,
+		Torque:          body.t,
+		IgnoreGravity:   body.IgnoreGravity,
+		Enabled:         body.Enabled,
+		Bullet:          body.Bullet,
+		Shapes:          make([]shapeJSON, 0, len(body.Shapes)),
+	}
+
+	for _, shape := range body.Shapes {
+		data, err := shape.ShapeClass.marshalShape(shape)
+		if err != nil {
+			return bodyData, err
+		}
+
+		bodyData.Shapes = append(bodyData.Shapes, shapeJSON{
+			Type:            shape.ShapeType().ToString(),
+			IsSensor:        shape.IsSensor,
+			Elasticity:      shape.e,
+			Friction:        shape.u,
+			SurfaceVelocity: shape.Surface_v,
+			Mass:            shape.mass,
+			Density:         shape.density,
+			CollisionType:   shape.CollisionType,
+			Group:           shape.Group,
+			Layer:           shape.Layer,
+			Data:            data,
+		})
+	}
+
+	return bodyData, nil
+}
+
+func unmarshalBody(bodyData *bodyJSON) (*Body, error) {
+	var body *Body
+	switch bodyData.Type {
+	case BodyType_Static:
+		body = NewBodyStatic()
+	case BodyType_Kinematic:
+		body = NewBodyKinematic()
+	case BodyType_Dynamic:
+		body = NewBody(bodyData.Mass, bodyData.Moment)
+	default:
+		return nil, fmt.Errorf("chipmunk: unknown body type %d", bodyData.Type)
+	}
+
+	body.p = bodyData.Position
+	body.v = bodyData.Velocity
+	body.f = bodyData.Force
+	body.setAngle(bodyData.Angle)
+	body.w = bodyData.AngularVelocity
+	body.t = bodyData.Torque
+	body.IgnoreGravity = bodyData.IgnoreGravity
+	body.Enabled = bodyData.Enabled
+	body.Bullet = bodyData.Bullet
+
+	for _, shapeData := range bodyData.Shapes {
+		var class ShapeClass
+		switch shapeData.Type {
+		case "Circle":
+			class = &CircleShape{}
+		case "Segment":
+			class = &SegmentShape{}
+		case "Polygon":
+			class = &PolygonShape{}
+		case "Box":
+			class = &BoxShape{}
+		default:
+			return nil, fmt.Errorf("chipmunk: unknown shape type %s", shapeData.Type)
+		}
+
+		shape := newShape()
+		err := class.unmarshalShape(shape, shapeData.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		shape.IsSensor = shapeData.IsSensor
+		shape.e = shapeData.Elasticity
+		shape.u = shapeData.Friction
+		shape.Surface_v = shapeData.SurfaceVelocity
+		shape.mass = shapeData.Mass
+		shape.density = shapeData.Density
+		shape.CollisionType = shapeData.CollisionType
+		shape.Group = shapeData.Group
+		shape.Layer = shapeData.Layer
+		body.AddShape(shape)
+	}
+
+	// The mass was saved with the body, set the automatic mass after the shapes so it isn't computed again.
+	body.autoMass = bodyData.AutoMass
+	body.cog = bodyData.CenterOfGravity
+
+	return body, nil
+}
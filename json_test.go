@@ -0,0 +1,173 @@
+package chipmunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// A space with every shape type, every body type and every constraint type.
+func jsonScene() *Space {
+	space := NewSpace()
+	space.Gravity = vect.Vect{0, -100}
+	space.Iterations = 15
+	space.SetDamping(0.9)
+	space.SetBBTreeExpansion(0.2, 0.3)
+
+	ground := NewBodyStatic()
+	ground.AddShape(NewSegment(vect.Vect{-100, 0}, vect.Vect{100, 0}, 1))
+	ground.AddShape(NewPolygon(Vertices{{-100, 0}, {-100, 20}, {-90, 0}}, vect.Vector_Zero))
+	space.AddBody(ground)
+
+	platform := NewBodyKinematic()
+	platform.AddShape(NewBox(vect.Vector_Zero, 20, 2))
+	platform.SetPosition(vect.Vect{50, 10})
+	platform.SetVelocity(-5, 0)
+	space.AddBody(platform)
+
+	shapes := []*Shape{
+		NewCircle(vect.Vect{1, 0}, 3),
+		NewBox(vect.Vector_Zero, 6, 4),
+		NewPolygon(Vertices{{-3, -3}, {0, 3}, {3, -3}}, vect.Vect{0, 1}),
+		NewSegment(vect.Vect{-4, 0}, vect.Vect{4, 0}, 1),
+	}
+	var bodies []*Body
+	for i, shape := range shapes {
+		shape.SetFriction(0.3 + vect.Float(i)*0.1)
+		shape.SetElasticity(0.1 * vect.Float(i))
+		shape.Layer = Layer(1 << uint(i))
+		shape.Layer |= 1
+		shape.Group = Group(i % 2)
+		shape.CollisionType = CollisionType(i)
+		shape.SetDensity(1)
+
+		body := NewBody(1, 1)
+		body.SetAutoMass(true)
+		body.AddShape(shape)
+		body.SetPosition(vect.Vect{vect.Float(i)*15 - 30, 20})
+		body.SetAngle(vect.Float(i) * 0.3)
+		body.SetVelocity(vect.Float(i), 2)
+		body.SetAngularVelocity(0.5)
+		space.AddBody(body)
+		bodies = append(bodies, body)
+	}
+
+	sensor := NewCircle(vect.Vector_Zero, 10)
+	sensor.IsSensor = true
+	bodies[0].AddShape(sensor)
+	space.AddShape(sensor)
+	bodies[3].IgnoreGravity = true
+
+	a, b, c, d := bodies[0], bodies[1], bodies[2], bodies[3]
+	space.AddConstraint(NewPivotJoint(a, b))
+	space.AddConstraint(NewPinJoint(b, c, vect.Vect{1, 0}, vect.Vect{0, 1}))
+	space.AddConstraint(NewSlideJoint(c, d, vect.Vector_Zero, vect.Vector_Zero, 5, 20))
+	space.AddConstraint(NewGrooveJoint(ground, d, vect.Vect{-50, 30}, vect.Vect{50, 30}, vect.Vector_Zero))
+	space.AddConstraint(NewDampedSpring(a, c, vect.Vector_Zero, vect.Vector_Zero, 30, 10, 1))
+	space.AddConstraint(NewDampedRotarySpring(a, d, 0.5, 10, 1))
+	space.AddConstraint(NewRotaryLimitJoint(b, d, -1, 1))
+	space.AddConstraint(NewRatchetJoint(a, platform, 0, 0.5))
+	space.AddConstraint(NewGearJoint(b, c, 0, 2))
+	space.AddConstraint(NewSimpleMotor(c, ground, 1))
+
+	return space
+}
+
+func TestSpaceJSONRoundTrip(t *testing.T) {
+	space := jsonScene()
+	data, err := json.Marshal(space)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := NewSpace()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	again, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Fatalf("encoding changed after a round trip:\n%s\n%s", data, again)
+	}
+
+	bodies, decodedBodies := space.allBodies(), decoded.allBodies()
+	for _, body := range decodedBodies {
+		if body.space != decoded {
+			t.Errorf("decoded body at %v is not in the decoded space", body.Position())
+		}
+		for _, shape := range body.Shapes {
+			if shape.Body != body || shape.space != decoded {
+				t.Errorf("decoded shape %v is not linked to its body", shape.ShapeType().ToString())
+			}
+		}
+	}
+
+	index := make(map[*Body]int)
+	for i, body := range decodedBodies {
+		index[body] = i
+	}
+	constraints, decodedConstraints := space.allConstraints(), decoded.allConstraints()
+	if len(decodedConstraints) != len(constraints) {
+		t.Fatalf("%d constraints, want %d", len(decodedConstraints), len(constraints))
+	}
+	for i, constraint := range decodedConstraints {
+		con, want := constraint.Constraint(), constraints[i].Constraint()
+		a, okA := index[con.BodyA]
+		b, okB := index[con.BodyB]
+		if !okA || !okB || bodies[a].p != want.BodyA.p || bodies[b].p != want.BodyB.p {
+			t.Errorf("constraint %d is not linked to the decoded bodies", i)
+		}
+	}
+
+	// The decoded space simulates exactly like the original one.
+	for i := 0; i < 120; i++ {
+		space.Step(1.0 / 60)
+		decoded.Step(1.0 / 60)
+	}
+	compareStates(t, "stepped", bodyStates(decoded.allBodies()), bodyStates(space.allBodies()))
+}
+
+func TestSpaceJSONKeepsWorkersAndIndexes(t *testing.T) {
+	data, err := json.Marshal(jsonScene())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	space, _ := floorScene()
+	space.SetWorkers(2)
+	defer space.Destroy()
+	space.UseSpatialHash(10, 1000)
+	handler := space.AddCollisionHandler(0, 1)
+
+	if err := json.Unmarshal(data, space); err != nil {
+		t.Fatal(err)
+	}
+	if space.Workers() != 2 || space.workerPool == nil {
+		t.Errorf("decoding stopped the workers")
+	}
+	if space.AddCollisionHandler(0, 1) != handler {
+		t.Errorf("decoding removed the collision handlers")
+	}
+	tree := GetTree(space.activeShapes.SpatialIndexClass)
+	if tree == nil || tree.Margin != 0.2 || tree.VelocityCoef != 0.3 {
+		t.Errorf("decoding didn't restore the BBTree of the encoded space")
+	}
+
+	// Invalid data leaves the space unchanged.
+	bodies := len(space.allBodies())
+	if err := json.Unmarshal([]byte(`{"Bodies":[{"Type":7}]}`), space); err == nil {
+		t.Errorf("decoded an unknown body type")
+	}
+	if len(space.allBodies()) != bodies {
+		t.Errorf("failed decoding changed the space")
+	}
+
+	var zero Space
+	if err := json.Unmarshal(data, &zero); err != nil || len(zero.allBodies()) != bodies {
+		t.Errorf("decoding into a zero space failed: %v", err)
+	}
+}
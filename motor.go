@@ -12,7 +12,7 @@ type SimpleMotor struct {
     BasicConstraint
     iSum vect.Float
     jAcc vect.Float
-    rate vect.Float
+    Rate vect.Float
 }
 
 /*
@@ -46,7 +46,7 @@ func (joint *SimpleMotor) ApplyImpulse() {
 	b := joint.BodyB
 	
 	// compute relative rotational velocity
-	wr := b.w - a.w + joint.rate
+	wr := b.w - a.w + joint.Rate
 	
 	jMax := joint.MaxForce
 	
@@ -88,19 +88,19 @@ func (joint *SimpleMotor) Impulse() vect.Float {
 GetRate returns the motor rate.
 */
 func (joint *SimpleMotor) GetRate() vect.Float {
-    return joint.rate
+    return joint.Rate
 }
 
 /*
 SetRate sets the motor rate (aka power).
 */
 func (joint *SimpleMotor) SetRate(rate vect.Float) {
-    joint.rate = rate
+    joint.Rate = rate
 }
 
 /*
 NewSimpleMotor creates a new motor joint.
 */
 func NewSimpleMotor(a, b *Body, rate vect.Float) *SimpleMotor {
-    return &SimpleMotor{BasicConstraint: NewConstraint(a, b), rate: rate, jAcc: 0.0}
+    return &SimpleMotor{BasicConstraint: NewConstraint(a, b), Rate: rate, jAcc: 0.0}
 }
\ No newline at end of file
@@ -0,0 +1,94 @@
+package chipmunk
+
+// Scenes with fewer pairs of shapes are collided serially, synchronizing the workers would cost more than it saves.
+const collideMinParallel = 256
+
+// Minimum number of pairs of shapes a worker collides at a time.
+const collideMinChunk = 32
+
+// Pair of shapes found by the broad phase and the contacts found by the narrow phase.
+type shapePair struct {
+	a, b        *Shape
+	contacts    []*Contact
+	numContacts int
+}
+
+// Contact buffers owned by a worker, so the workers don't share the pool of the space.
+type collideWorker struct {
+	contacts [][]*Contact
+}
+
+func (worker *collideWorker) pullContactBuffer() (contacts []*Contact) {
+	last := len(worker.contacts) - 1
+	contacts, worker.contacts = worker.contacts[last], worker.contacts[:last]
+	return
+}
+
+func (worker *collideWorker) pushContactBuffer(contacts []*Contact) {
+	worker.contacts = append(worker.contacts, contacts)
+}
+
+// Collects the pairs of shapes passing the broad phase, they are collided by collidePairs.
+func (space *Space) collectPair(a, b *Shape) {
+	if queryReject(a, b) {
+		return
+	}
+
+	if a.ShapeType() > b.ShapeType() {
+		a, b = b, a
+	}
+
+	space.shapePairs = append(space.shapePairs, shapePair{a: a, b: b})
+}
+
+// Collides the collected pairs on the workers, then creates and updates their arbiters in the order
+// the pairs were collected so the results don't depend on the number of workers.
+func (space *Space) collidePairs() {
+	pairs := space.shapePairs
+	parts := space.workerParts(len(pairs), collideMinChunk)
+	if len(pairs) < collideMinParallel {
+		parts = 1
+	}
+
+	// Give every worker enough contact buffers for all of its pairs, the workers never allocate.
+	chunk := (len(pairs) + parts - 1) / parts
+	for i := 0; i < parts; i++ {
+		worker := &space.collideWorkers[i]
+		for len(worker.contacts) < chunk {
+			worker.pushContactBuffer(space.pullContactBuffer())
+		}
+	}
+
+	collidePart := func(part int) {
+		worker := &space.collideWorkers[part]
+		end := (part + 1) * chunk
+		if end > len(pairs) {
+			end = len(pairs)
+		}
+		for i := part * chunk; i < end; i++ {
+			pair := &pairs[i]
+			contacts := worker.pullContactBuffer()
+			numContacts := collide(contacts, pair.a, pair.b)
+			if numContacts <= 0 {
+				worker.pushContactBuffer(contacts)
+				continue
+			}
+			pair.contacts, pair.numContacts = contacts[:numContacts], numContacts
+		}
+	}
+
+	if parts == 1 {
+		collidePart(0)
+	} else {
+		space.workerPool.run(parts, collidePart)
+	}
+
+	for i := range pairs {
+		pair := &pairs[i]
+		if pair.contacts != nil {
+			space.collideShapesContacts(pair.a, pair.b, pair.contacts, pair.numContacts)
+		}
+		*pair = shapePair{}
+	}
+	space.shapePairs = pairs[0:0]
+}
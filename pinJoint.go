@@ -0,0 +1,82 @@
+package chipmunk
+
+import (
+	"github.com/vova616/chipmunk/transform"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// PinJoint keeps the anchor points of two bodies at a fixed distance.
+type PinJoint struct {
+	BasicConstraint
+	Anchor1, Anchor2 vect.Vect
+	Dist             vect.Float
+
+	r1, r2 vect.Vect
+	n      vect.Vect
+	nMass  vect.Float
+
+	jnAcc, jnMax vect.Float
+	bias         vect.Float
+}
+
+// Creates a pin joint, the distance is taken from the current positions of the anchors.
+func NewPinJoint(a, b *Body, anchor1, anchor2 vect.Vect) *PinJoint {
+	p1 := vect.Add(a.p, transform.RotateVect(vect.Sub(anchor1, a.cog), transform.Rotation{a.rot.X, a.rot.Y}))
+	p2 := vect.Add(b.p, transform.RotateVect(vect.Sub(anchor2, b.cog), transform.Rotation{b.rot.X, b.rot.Y}))
+
+	return &PinJoint{
+		BasicConstraint: NewConstraint(a, b),
+		Anchor1:         anchor1,
+		Anchor2:         anchor2,
+		Dist:            vect.Dist(p1, p2),
+	}
+}
+
+func (this *PinJoint) PreStep(dt vect.Float) {
+	a, b := this.BodyA, this.BodyB
+
+	this.r1 = transform.RotateVect(vect.Sub(this.Anchor1, a.cog), transform.Rotation{a.rot.X, a.rot.Y})
+	this.r2 = transform.RotateVect(vect.Sub(this.Anchor2, b.cog), transform.Rotation{b.rot.X, b.rot.Y})
+
+	delta := vect.Sub(vect.Add(b.p, this.r2), vect.Add(a.p, this.r1))
+	dist := vect.Length(delta)
+	if dist != 0 {
+		this.n = vect.Mult(delta, 1/dist)
+	} else {
+		this.n = vect.Vector_Zero
+	}
+
+	// calculate mass normal
+	this.nMass = 1.0 / k_scalar(a, b, this.r1, this.r2, this.n)
+
+	// compute max impulse
+	this.jnMax = this.MaxForce * dt
+
+	// calculate bias velocity
+	this.bias = vect.FClamp(-bias_coef(this.ErrorBias, dt)*(dist-this.Dist)/dt, -this.MaxBias, this.MaxBias)
+}
+
+func (this *PinJoint) ApplyCachedImpulse(dt_coef vect.Float) {
+	apply_impulses(this.BodyA, this.BodyB, this.r1, this.r2, vect.Mult(this.n, this.jnAcc*dt_coef))
+}
+
+func (this *PinJoint) ApplyImpulse() {
+	a, b := this.BodyA, this.BodyB
+	n := this.n
+
+	// compute relative velocity
+	vrn := normal_relative_velocity(a, b, this.r1, this.r2, n)
+
+	// compute normal impulse
+	jn := (this.bias - vrn) * this.nMass
+	jnOld := this.jnAcc
+	this.jnAcc = vect.FClamp(jnOld+jn, -this.jnMax, this.jnMax)
+	jn = this.jnAcc - jnOld
+
+	// apply impulse
+	apply_impulses(a, b, this.r1, this.r2, vect.Mult(n, jn))
+}
+
+func (this *PinJoint) Impulse() vect.Float {
+	return vect.FAbs(this.jnAcc)
+}
@@ -29,8 +29,8 @@ func NewPivotJoint(a, b *Body) *PivotJoint {
 func (this *PivotJoint) PreStep(dt vect.Float) {
 	a, b := this.BodyA, this.BodyB
 
-	this.r1 = transform.RotateVect(this.Anchor1, transform.Rotation{a.rot.X, a.rot.Y})
-	this.r2 = transform.RotateVect(this.Anchor2, transform.Rotation{b.rot.X, b.rot.Y})
+	this.r1 = transform.RotateVect(vect.Sub(this.Anchor1, a.cog), transform.Rotation{a.rot.X, a.rot.Y})
+	this.r2 = transform.RotateVect(vect.Sub(this.Anchor2, b.cog), transform.Rotation{b.rot.X, b.rot.Y})
 
 	// Calculate mass tensor
 	k_tensor(a, b, this.r1, this.r2, &this.k1, &this.k2)
@@ -1,6 +1,10 @@
 package chipmunk
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
 	"github.com/vova616/chipmunk/transform"
 	"github.com/vova616/chipmunk/vect"
 
@@ -47,30 +51,48 @@ func NewPolygon(verts Vertices, offset vect.Vect) *Shape {
 	return shape
 }
 
-func (poly *PolygonShape) Moment(mass float32) vect.Float {
+// Creates a new PolygonShape like NewPolygon, but returns an error instead of building a broken polygon.
+// Counter-clockwise vertices are reversed, vertices that are not convex should be passed through ConvexHull first.
+// Consecutive duplicate vertices are removed, their zero length edge has no normal.
+func NewPolygonChecked(verts Vertices, offset vect.Vect) (*Shape, error) {
+	verts = verts.withoutDuplicates()
+	if len(verts) < 3 {
+		return nil, fmt.Errorf("chipmunk: a polygon needs at least 3 vertices, got %d", len(verts))
+	}
 
-	sum1 := vect.Float(0)
-	sum2 := vect.Float(0)
+	if !verts.IsClockwise() {
+		verts = verts.Reversed()
+	}
 
-	println("using bad Moment calculation")
-	offset := vect.Vect{0, 0}
+	if AreaForPoly(verts) <= 0 {
+		return nil, errors.New("chipmunk: polygon vertices have no area")
+	}
 
-	for i := 0; i < poly.NumVerts; i++ {
+	if !verts.ValidatePolygon() {
+		return nil, errors.New("chipmunk: polygon vertices are not convex")
+	}
+
+	return NewPolygon(verts, offset), nil
+}
 
-		v1 := vect.Add(poly.Verts[i], offset)
-		v2 := vect.Add(poly.Verts[(i+1)%poly.NumVerts], offset)
+func (poly *PolygonShape) Moment(mass vect.Float) vect.Float {
+	return MomentForPoly(mass, poly.Verts, vect.Vector_Zero)
+}
 
-		a := vect.Cross(v2, v1)
-		b := vect.Dot(v1, v1) + vect.Dot(v1, v2) + vect.Dot(v2, v2)
+func (poly *PolygonShape) Area() vect.Float {
+	return AreaForPoly(poly.Verts)
+}
 
-		sum1 += a * b
-		sum2 += a
-	}
+func (poly *PolygonShape) Centroid() vect.Vect {
+	return CentroidForPoly(poly.Verts)
+}
 
-	return (vect.Float(mass) * sum1) / (6.0 * sum2)
+func (poly *PolygonShape) centroidMoment(mass vect.Float) vect.Float {
+	return MomentForPoly(mass, poly.Verts, vect.Mult(poly.Centroid(), -1))
 }
 
-// Sets the vertices offset by the offset and calculates the PolygonAxes.
+// Sets the vertices offset by the offset, calculates the PolygonAxes and updates the mass of the body.
+// Counter-clockwise vertices are reversed.
 func (poly *PolygonShape) SetVerts(verts Vertices, offset vect.Vect) {
 
 	if verts == nil {
@@ -78,6 +100,10 @@ func (poly *PolygonShape) SetVerts(verts Vertices, offset vect.Vect) {
 		return
 	}
 
+	if !verts.IsClockwise() {
+		verts = verts.Reversed()
+	}
+
 	if verts.ValidatePolygon() == false {
 		log.Printf("Warning: vertices not valid")
 	}
@@ -110,6 +136,10 @@ func (poly *PolygonShape) SetVerts(verts Vertices, offset vect.Vect) {
 		poly.Axes[i].N = n
 		poly.Axes[i].D = vect.Dot(n, a)
 	}
+
+	if poly.Shape != nil {
+		poly.Shape.updateBodyMass()
+	}
 }
 
 // Returns ShapeType_Polygon. Needed to implemet the ShapeClass interface.
@@ -195,6 +225,77 @@ func (poly *PolygonShape) TestPoint(point vect.Vect) bool {
 	return poly.ContainsVert(point)
 }
 
+func (poly *PolygonShape) segmentQuery(a, b vect.Vect, info *SegmentQueryInfo) {
+	axes := poly.TAxes
+	verts := poly.TVerts
+	numVerts := poly.NumVerts
+
+	for i := 0; i < numVerts; i++ {
+		n := axes[i].N
+		an := vect.Dot(a, n)
+		if axes[i].D > an {
+			continue
+		}
+
+		bn := vect.Dot(b, n)
+		t := (axes[i].D - an) / (bn - an)
+		if t < 0 || 1 < t {
+			continue
+		}
+
+		point := vect.Add(a, vect.Mult(vect.Sub(b, a), t))
+		dt := -vect.Cross(n, point)
+		dtMin := -vect.Cross(n, verts[i])
+		dtMax := -vect.Cross(n, verts[(i+1)%numVerts])
+
+		if dtMin <= dt && dt <= dtMax {
+			info.Shape = poly.Shape
+			info.T = t
+			info.Normal = n
+		}
+	}
+}
+
+func (poly *PolygonShape) nearestPointQuery(p vect.Vect) NearestPointQueryInfo {
+	axes := poly.TAxes
+	verts := poly.TVerts
+	numVerts := poly.NumVerts
+
+	minDist := Inf
+	closestPoint := vect.Vector_Zero
+	closestNormal := vect.Vector_Zero
+	outside := false
+
+	for i := 0; i < numVerts; i++ {
+		if vect.Dot(axes[i].N, p)-axes[i].D > 0 {
+			outside = true
+		}
+
+		closest, _ := closestPointOnSegment(p, verts[i], verts[(i+1)%numVerts])
+
+		dist := vect.Dist(p, closest)
+		if dist < minDist {
+			minDist = dist
+			closestPoint = closest
+			closestNormal = axes[i].N
+		}
+	}
+
+	dist := minDist
+	if !outside {
+		dist = -minDist
+	}
+
+	info := NearestPointQueryInfo{Point: closestPoint, Distance: dist}
+	if minDist > magicEpsilon {
+		info.Gradient = vect.Mult(vect.Sub(p, closestPoint), 1/dist)
+	} else {
+		// Use the normal of the closest segment if the distance is small.
+		info.Gradient = closestNormal
+	}
+	return info
+}
+
 func (poly *PolygonShape) ContainsVert(v vect.Vect) bool {
 	for _, axis := range poly.TAxes {
 		dist := vect.Dot(axis.N, v) - axis.D
@@ -230,3 +331,25 @@ func (poly *PolygonShape) ValueOnAxis(n vect.Vect, d vect.Float) vect.Float {
 
 	return min - d
 }
+
+func (poly *PolygonShape) marshalShape(shape *Shape) ([]byte, error) {
+	return json.Marshal(struct {
+		Verts Vertices
+	}{poly.Verts})
+}
+
+func (poly *PolygonShape) unmarshalShape(shape *Shape, data []byte) error {
+	polyData := struct {
+		Verts Vertices
+	}{}
+
+	err := json.Unmarshal(data, &polyData)
+	if err != nil {
+		return err
+	}
+
+	poly.SetVerts(polyData.Verts, vect.Vector_Zero)
+	poly.Shape = shape
+	shape.ShapeClass = poly
+	return nil
+}
@@ -0,0 +1,46 @@
+package chipmunk
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+func TestNewPolygonCheckedDuplicates(t *testing.T) {
+	for _, verts := range []Vertices{
+		{{0, 0}, {0, 10}, {0, 10}, {10, 10}, {10, 0}},
+		{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}},
+		{{0, 0}, {0, 0}, {10, 0}, {10, 0}, {10, 10}, {10, 10}, {0, 10}},
+	} {
+		shape, err := NewPolygonChecked(verts, vect.Vector_Zero)
+		if err != nil {
+			t.Fatalf("%v: %v", verts, err)
+		}
+
+		poly := shape.GetAsPolygon()
+		if poly.NumVerts != 4 {
+			t.Errorf("%v: %d vertices, want 4", verts, poly.NumVerts)
+		}
+		for _, axis := range poly.Axes {
+			if math.IsNaN(float64(axis.N.X)) || math.IsNaN(float64(axis.N.Y)) || math.IsNaN(float64(axis.D)) {
+				t.Errorf("%v: axis %v is NaN", verts, axis)
+			}
+		}
+	}
+}
+
+func TestNewPolygonCheckedInvalid(t *testing.T) {
+	for _, verts := range []Vertices{
+		nil,
+		{{0, 0}, {10, 0}},
+		{{0, 0}, {10, 0}, {10, 0}},
+		{{5, 5}, {5, 5}, {5, 5}, {5, 5}},
+		{{0, 0}, {5, 5}, {10, 10}},
+		{{0, 0}, {0, 10}, {5, 5}, {10, 10}, {10, 0}},
+	} {
+		if _, err := NewPolygonChecked(verts, vect.Vector_Zero); err == nil {
+			t.Errorf("%v: no error", verts)
+		}
+	}
+}
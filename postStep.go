@@ -0,0 +1,78 @@
+package chipmunk
+
+// Post-step callback function, key is the value passed to AddPostStepCallback.
+type PostStepFunc func(space *Space, key interface{})
+
+type postStepCallback struct {
+	key interface{}
+	fn  PostStepFunc
+}
+
+// Key used by the add and remove functions when they are deferred.
+type postStepOp struct {
+	obj    interface{}
+	remove bool
+}
+
+// Returns true while the space is stepping or running a query,
+// add and remove calls made while it is locked are delayed until it is unlocked.
+func (space *Space) IsLocked() bool {
+	return space.locked > 0
+}
+
+// Schedules fn to be called after the current step (or query) when it is safe to modify the space.
+// Only one callback can be registered per key, returns false if the key is already used.
+// The key must be comparable with ==, keys like slices or maps panic.
+// Callbacks added while the space is not locked are called at the end of the next step or query.
+func (space *Space) AddPostStepCallback(key interface{}, fn PostStepFunc) bool {
+	for _, callback := range space.postStepCallbacks {
+		if callback.key == key {
+			return false
+		}
+	}
+
+	space.postStepCallbacks = append(space.postStepCallbacks, postStepCallback{key, fn})
+	return true
+}
+
+func (space *Space) assertUnlocked() {
+	if space.IsLocked() {
+		panic("This operation cannot be done safely during a call to Space.Step() or during a query. Put these calls into a post-step callback.")
+	}
+}
+
+func (space *Space) lock() {
+	space.locked++
+}
+
+func (space *Space) unlock(runPostStep bool) {
+	space.locked--
+	if space.locked < 0 {
+		panic("Internal Error: Space lock underflow.")
+	}
+
+	if space.locked != 0 {
+		return
+	}
+
+	waking := space.rousedBodies
+	space.rousedBodies = nil
+	for _, body := range waking {
+		space.ActiveBody(body)
+	}
+
+	if runPostStep && !space.skipPostStep {
+		space.skipPostStep = true
+		// The callbacks left when one panics are dropped instead of running again after the next step.
+		defer func() {
+			space.postStepCallbacks = space.postStepCallbacks[0:0]
+			space.skipPostStep = false
+		}()
+
+		// Callbacks may add more callbacks, those are called as well.
+		for i := 0; i < len(space.postStepCallbacks); i++ {
+			callback := space.postStepCallbacks[i]
+			callback.fn(space, callback.key)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package chipmunk
+
+import (
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+func TestPostStepCallbackKeys(t *testing.T) {
+	space := NewSpace()
+	calls := make(map[interface{}]int)
+	count := func(space *Space, key interface{}) {
+		calls[key]++
+	}
+
+	// Only the first callback of a key is kept.
+	if !space.AddPostStepCallback("a", count) || !space.AddPostStepCallback("b", count) {
+		t.Fatal("callbacks with new keys were not added")
+	}
+	if space.AddPostStepCallback("a", func(space *Space, key interface{}) { t.Error("second callback of a key called") }) {
+		t.Error("callback with a used key was added")
+	}
+
+	space.Step(1.0 / 60)
+	if calls["a"] != 1 || calls["b"] != 1 {
+		t.Errorf("callbacks called %v, want once each", calls)
+	}
+
+	// Keys can be used again once their callback was called.
+	if !space.AddPostStepCallback("a", count) {
+		t.Error("key not released after its callback was called")
+	}
+	space.Step(1.0 / 60)
+	space.Step(1.0 / 60)
+	if calls["a"] != 2 {
+		t.Errorf("callback called %d times, want 2", calls["a"])
+	}
+}
+
+func TestDeferredChanges(t *testing.T) {
+	space, floor, box := handlerScene()
+	extra := NewBody(1, 1)
+	extra.AddShape(NewCircle(vect.Vector_Zero, 1))
+
+	// Changes made from a collision callback are applied after the step.
+	space.AddCollisionHandler(1, 2).BeginFunc = func(arb *Arbiter, space *Space) bool {
+		if !space.IsLocked() {
+			t.Error("space not locked in a collision callback")
+		}
+		space.RemoveBody(box.Body)
+		space.AddBody(extra)
+		if !containsBody(space.Bodies, box.Body) || containsBody(space.Bodies, extra) || extra.space != nil {
+			t.Error("bodies changed during the step")
+		}
+		return true
+	}
+
+	space.Step(1.0 / 60)
+	if space.IsLocked() {
+		t.Error("space still locked after the step")
+	}
+	if containsBody(space.Bodies, box.Body) || !containsBody(space.Bodies, extra) {
+		t.Error("changes made during the step were not applied after it")
+	}
+	if indexContains(space.activeShapes, box) || !indexContains(space.activeShapes, extra.Shapes[0]) || !indexContains(space.staticShapes, floor) {
+		t.Error("shapes of the changed bodies were not updated after the step")
+	}
+}
+
+func TestAssertUnlocked(t *testing.T) {
+	space, _, _ := handlerScene()
+	operations := map[string]func(){
+		"UseSpatialHash": func() { space.UseSpatialHash(10, 100) },
+		"Snapshot":       func() { space.Snapshot() },
+		"SetWorkers":     func() { space.SetWorkers(2) },
+	}
+
+	panicked := make(map[string]bool)
+	space.AddCollisionHandler(1, 2).PreSolveFunc = func(arb *Arbiter, space *Space) bool {
+		for name, operation := range operations {
+			func() {
+				defer func() {
+					panicked[name] = recover() != nil
+				}()
+				operation()
+			}()
+		}
+		return true
+	}
+
+	space.Step(1.0 / 60)
+	for name := range operations {
+		if !panicked[name] {
+			t.Errorf("%s did not panic while the space was locked", name)
+		}
+	}
+
+	// They are fine once the step is over.
+	for name, operation := range operations {
+		func() {
+			defer func() {
+				if recover() != nil {
+					t.Errorf("%s panicked after the step", name)
+				}
+			}()
+			operation()
+		}()
+	}
+}
+
+func TestPanickingCallback(t *testing.T) {
+	space, _, _ := handlerScene()
+	handler := space.AddCollisionHandler(1, 2)
+	handler.BeginFunc = func(arb *Arbiter, space *Space) bool {
+		panic("begin")
+	}
+	space.AddPostStepCallback("panic", func(space *Space, key interface{}) {
+		panic("post-step")
+	})
+	space.AddPostStepCallback("dropped", func(space *Space, key interface{}) {
+		t.Error("callback after a panicking one called")
+	})
+
+	step := func() (recovered interface{}) {
+		defer func() {
+			recovered = recover()
+		}()
+		space.Step(1.0 / 60)
+		return nil
+	}
+
+	// The space is unlocked after a collision callback or a post-step callback panics.
+	if r := step(); r != "begin" {
+		t.Fatalf("step recovered %v, want the panic of the begin callback", r)
+	}
+	if space.IsLocked() {
+		t.Fatal("space locked after a collision callback panicked")
+	}
+
+	handler.BeginFunc = nil
+	if r := step(); r != "post-step" {
+		t.Fatalf("step recovered %v, want the panic of the post-step callback", r)
+	}
+	if space.IsLocked() {
+		t.Fatal("space locked after a post-step callback panicked")
+	}
+
+	// Later steps and callbacks work as usual.
+	called := false
+	space.AddPostStepCallback("panic", func(space *Space, key interface{}) {
+		called = true
+	})
+	if r := step(); r != nil || !called {
+		t.Errorf("step after the panics recovered %v and called the callback %v", r, called)
+	}
+}
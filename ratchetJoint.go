@@ -0,0 +1,90 @@
+package chipmunk
+
+import (
+	"math"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// RatchetJoint works like a socket wrench, the relative angle of the bodies
+// can only increase (or decrease for a negative Ratchet) in steps of Ratchet.
+type RatchetJoint struct {
+	BasicConstraint
+	Angle, Phase, Ratchet vect.Float
+
+	iSum vect.Float
+	bias vect.Float
+	jAcc vect.Float
+	jMax vect.Float
+}
+
+func NewRatchetJoint(a, b *Body, phase, ratchet vect.Float) *RatchetJoint {
+	return &RatchetJoint{
+		BasicConstraint: NewConstraint(a, b),
+		Angle:           b.a - a.a,
+		Phase:           phase,
+		Ratchet:         ratchet,
+	}
+}
+
+func (joint *RatchetJoint) PreStep(dt vect.Float) {
+	a, b := joint.BodyA, joint.BodyB
+
+	delta := b.a - a.a
+	diff := joint.Angle - delta
+	pdist := vect.Float(0)
+
+	if diff*joint.Ratchet > 0 {
+		pdist = diff
+	} else {
+		joint.Angle = vect.Float(math.Floor(float64((delta-joint.Phase)/joint.Ratchet)))*joint.Ratchet + joint.Phase
+	}
+
+	// calculate moment of inertia coefficient.
+	joint.iSum = 1.0 / (a.i_inv + b.i_inv)
+
+	// calculate bias velocity
+	joint.bias = vect.FClamp(-bias_coef(joint.ErrorBias, dt)*pdist/dt, -joint.MaxBias, joint.MaxBias)
+
+	// compute max impulse
+	joint.jMax = joint.MaxForce * dt
+
+	// If the bias is 0, the joint is not at a limit. Reset the impulse.
+	if joint.bias == 0 {
+		joint.jAcc = 0
+	}
+}
+
+func (joint *RatchetJoint) ApplyCachedImpulse(dt_coef vect.Float) {
+	a, b := joint.BodyA, joint.BodyB
+
+	j := joint.jAcc * dt_coef
+	a.w -= j * a.i_inv
+	b.w += j * b.i_inv
+}
+
+func (joint *RatchetJoint) ApplyImpulse() {
+	if joint.bias == 0 {
+		return // early exit
+	}
+
+	a, b := joint.BodyA, joint.BodyB
+
+	// compute relative rotational velocity
+	wr := b.w - a.w
+	ratchet := joint.Ratchet
+
+	// compute normal impulse
+	j := -(joint.bias + wr) * joint.iSum
+	jOld := joint.jAcc
+	joint.jAcc = vect.FClamp((jOld+j)*ratchet, 0, joint.jMax*vect.FAbs(ratchet)) / ratchet
+	j = joint.jAcc - jOld
+
+	// apply impulse
+	a.w -= j * a.i_inv
+	b.w += j * b.i_inv
+}
+
+func (joint *RatchetJoint) Impulse() vect.Float {
+	return vect.FAbs(joint.jAcc)
+}
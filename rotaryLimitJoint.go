@@ -0,0 +1,87 @@
+package chipmunk
+
+import (
+	"github.com/vova616/chipmunk/vect"
+)
+
+// RotaryLimitJoint constrains the relative angle of two bodies between Min and Max.
+type RotaryLimitJoint struct {
+	BasicConstraint
+	Min, Max vect.Float
+
+	iSum vect.Float
+	bias vect.Float
+	jAcc vect.Float
+	jMax vect.Float
+}
+
+func NewRotaryLimitJoint(a, b *Body, min, max vect.Float) *RotaryLimitJoint {
+	return &RotaryLimitJoint{
+		BasicConstraint: NewConstraint(a, b),
+		Min:             min,
+		Max:             max,
+	}
+}
+
+func (joint *RotaryLimitJoint) PreStep(dt vect.Float) {
+	a, b := joint.BodyA, joint.BodyB
+
+	dist := b.a - a.a
+	pdist := vect.Float(0)
+	if dist > joint.Max {
+		pdist = joint.Max - dist
+	} else if dist < joint.Min {
+		pdist = joint.Min - dist
+	}
+
+	// calculate moment of inertia coefficient.
+	joint.iSum = 1.0 / (a.i_inv + b.i_inv)
+
+	// calculate bias velocity
+	joint.bias = vect.FClamp(-bias_coef(joint.ErrorBias, dt)*pdist/dt, -joint.MaxBias, joint.MaxBias)
+
+	// compute max impulse
+	joint.jMax = joint.MaxForce * dt
+
+	// If the bias is 0, the joint is not at a limit. Reset the impulse.
+	if joint.bias == 0 {
+		joint.jAcc = 0
+	}
+}
+
+func (joint *RotaryLimitJoint) ApplyCachedImpulse(dt_coef vect.Float) {
+	a, b := joint.BodyA, joint.BodyB
+
+	j := joint.jAcc * dt_coef
+	a.w -= j * a.i_inv
+	b.w += j * b.i_inv
+}
+
+func (joint *RotaryLimitJoint) ApplyImpulse() {
+	if joint.bias == 0 {
+		return // early exit
+	}
+
+	a, b := joint.BodyA, joint.BodyB
+
+	// compute relative rotational velocity
+	wr := b.w - a.w
+
+	// compute normal impulse
+	j := -(joint.bias + wr) * joint.iSum
+	jOld := joint.jAcc
+	if joint.bias < 0 {
+		joint.jAcc = vect.FClamp(jOld+j, 0, joint.jMax)
+	} else {
+		joint.jAcc = vect.FClamp(jOld+j, -joint.jMax, 0)
+	}
+	j = joint.jAcc - jOld
+
+	// apply impulse
+	a.w -= j * a.i_inv
+	b.w += j * b.i_inv
+}
+
+func (joint *RotaryLimitJoint) Impulse() vect.Float {
+	return vect.FAbs(joint.jAcc)
+}
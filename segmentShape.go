@@ -1,6 +1,8 @@
 package chipmunk
 
 import (
+	"encoding/json"
+
 	"github.com/vova616/chipmunk/transform"
 	"github.com/vova616/chipmunk/vect"
 )
@@ -22,6 +24,8 @@ type SegmentShape struct {
 
 	//tangents at the start/end when chained with other segments. Do not touch!
 	A_tangent, B_tangent vect.Vect
+	//local tangents set by SetNeighbors.
+	aTangent, bTangent vect.Vect
 }
 
 // Creates a new SegmentShape with the given points and radius.
@@ -42,11 +46,34 @@ func (segment *SegmentShape) ShapeType() ShapeType {
 	return ShapeType_Segment
 }
 
-func (segment *SegmentShape) Moment(mass float32) vect.Float {
+func (segment *SegmentShape) Moment(mass vect.Float) vect.Float {
+	return MomentForSegment(mass, segment.A, segment.B, segment.Radius)
+}
+
+// Returns the area of the segment, segments without a radius have no area.
+func (segment *SegmentShape) Area() vect.Float {
+	return AreaForSegment(segment.A, segment.B, segment.Radius)
+}
+
+func (segment *SegmentShape) Centroid() vect.Vect {
+	return vect.Mult(vect.Add(segment.A, segment.B), 0.5)
+}
+
+func (segment *SegmentShape) centroidMoment(mass vect.Float) vect.Float {
+	return momentForSegmentCentroid(mass, segment.A, segment.B, segment.Radius)
+}
 
-	offset := vect.Mult(vect.Add(segment.A, segment.B), 0.5)
+// Sets the start/end points of the segment and updates the mass of its body.
+func (segment *SegmentShape) SetEndpoints(a, b vect.Vect) {
+	segment.A = a
+	segment.B = b
+	segment.Shape.updateBodyMass()
+}
 
-	return vect.Float(mass) * (vect.DistSqr(segment.B, segment.A)/12.0 + vect.LengthSqr(offset))
+// Sets the radius of the segment and updates the mass of its body.
+func (segment *SegmentShape) SetRadius(radius vect.Float) {
+	segment.Radius = radius
+	segment.Shape.updateBodyMass()
 }
 
 //Called to update N, Tn, Ta, Tb and the the bounding box.
@@ -57,6 +84,8 @@ func (segment *SegmentShape) update(xf transform.Transform) AABB {
 	segment.Tb = b
 	segment.N = vect.Perp(vect.Normalize(vect.Sub(segment.B, segment.A)))
 	segment.Tn = xf.RotateVect(segment.N)
+	segment.A_tangent = xf.RotateVect(segment.aTangent)
+	segment.B_tangent = xf.RotateVect(segment.bTangent)
 
 	rv := vect.Vect{segment.Radius, segment.Radius}
 
@@ -72,13 +101,111 @@ func (segment *SegmentShape) update(xf transform.Transform) AABB {
 	}
 }
 
+// Chains the segment with its neighbours so shapes don't catch on the seams between them.
+// prev is the other end of the segment attached to A and next the other end of the one attached to B.
+func (segment *SegmentShape) SetNeighbors(prev, next vect.Vect) {
+	segment.aTangent = vect.Sub(prev, segment.A)
+	segment.bTangent = vect.Sub(next, segment.B)
+}
+
 func (segment *SegmentShape) Clone(s *Shape) ShapeClass {
 	clone := *segment
 	clone.Shape = s
 	return &clone
 }
 
-// Only returns false for now.
+// Returns true if the given point is located inside the segment, including its radius.
 func (segment *SegmentShape) TestPoint(point vect.Vect) bool {
-	return false
+	closest, _ := closestPointOnSegment(point, segment.Ta, segment.Tb)
+	return vect.DistSqr(point, closest) <= segment.Radius*segment.Radius
+}
+
+func (segment *SegmentShape) nearestPointQuery(p vect.Vect) NearestPointQueryInfo {
+	closest, _ := closestPointOnSegment(p, segment.Ta, segment.Tb)
+	delta := vect.Sub(p, closest)
+	d := delta.Length()
+	r := segment.Radius
+
+	info := NearestPointQueryInfo{Point: closest, Distance: d - r}
+	if d > magicEpsilon {
+		g := vect.Mult(delta, 1/d)
+		info.Point = vect.Add(closest, vect.Mult(g, r))
+		info.Gradient = g
+	} else {
+		// Use the segment's normal if the distance is very small.
+		info.Point = vect.Add(closest, vect.Mult(segment.Tn, r))
+		info.Gradient = segment.Tn
+	}
+	return info
+}
+
+func (segment *SegmentShape) segmentQuery(a, b vect.Vect, info *SegmentQueryInfo) {
+	n := segment.Tn
+	d := vect.Dot(vect.Sub(segment.Ta, a), n)
+	r := segment.Radius
+
+	flippedN := n
+	if d > 0 {
+		flippedN = vect.Mult(n, -1)
+	}
+	segOffset := vect.Sub(vect.Mult(flippedN, r), a)
+
+	// Make the endpoints relative to 'a' and move them by the thickness of the segment.
+	segA := vect.Add(segment.Ta, segOffset)
+	segB := vect.Add(segment.Tb, segOffset)
+	delta := vect.Sub(b, a)
+
+	if vect.Cross(delta, segA)*vect.Cross(delta, segB) <= 0 {
+		dOffset := d + r
+		if d > 0 {
+			dOffset = d - r
+		}
+		ad := -dOffset
+		bd := vect.Dot(delta, n) - dOffset
+
+		if ad*bd < 0 {
+			info.Shape = segment.Shape
+			info.T = ad / (ad - bd)
+			info.Normal = flippedN
+		}
+	} else if r != 0 {
+		info1 := SegmentQueryInfo{T: 1}
+		info2 := SegmentQueryInfo{T: 1}
+		circleSegmentQuery(segment.Shape, segment.Ta, r, a, b, &info1)
+		circleSegmentQuery(segment.Shape, segment.Tb, r, a, b, &info2)
+
+		if info1.T < info2.T {
+			*info = info1
+		} else {
+			*info = info2
+		}
+	}
+}
+
+type segmentData struct {
+	A, B               vect.Vect
+	Radius             vect.Float
+	ATangent, BTangent vect.Vect
+}
+
+func (segment *SegmentShape) marshalShape(shape *Shape) ([]byte, error) {
+	return json.Marshal(&segmentData{segment.A, segment.B, segment.Radius, segment.aTangent, segment.bTangent})
+}
+
+func (segment *SegmentShape) unmarshalShape(shape *Shape, data []byte) error {
+	segData := segmentData{}
+
+	err := json.Unmarshal(data, &segData)
+	if err != nil {
+		return err
+	}
+
+	segment.A = segData.A
+	segment.B = segData.B
+	segment.Radius = segData.Radius
+	segment.aTangent = segData.ATangent
+	segment.bTangent = segData.BTangent
+	segment.Shape = shape
+	shape.ShapeClass = segment
+	return nil
 }
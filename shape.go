@@ -1,7 +1,6 @@
 package chipmunk
 
 import (
-	"github.com/vova616/chipmunk/transform"
 	"github.com/vova616/chipmunk/vect"
 	"math"
 	//"fmt"
@@ -36,13 +35,18 @@ type Shape struct {
 	/// Surface velocity used when solving for friction.
 	Surface_v vect.Vect
 
+	// Mass of the shape, used by bodies with automatic mass. Set with SetMass or SetDensity.
+	mass vect.Float
+	// Density of the shape, the mass is the density times the area when it is set.
+	density vect.Float
+
 	/// User definable data pointer.
 	/// Generally this points to your the game object class so you can access it
 	/// when given a cpShape reference in a callback.
 	UserData interface{}
 
 	/// Collision type of this shape used when picking collision handlers.
-	//collision_type CollisionType
+	CollisionType CollisionType
 	/// Group of this shape. Shapes in the same group don't collide.
 	Group Group
 	// Layer bitmask for this shape. Shapes only collide if the bitwise and of their layers is non-zero.
@@ -53,6 +57,33 @@ type Shape struct {
 	velocityIndexed bool
 }
 
+// Result of a segment query against a shape.
+type SegmentQueryInfo struct {
+	// The shape that was hit, nil if no collision occurred.
+	Shape *Shape
+	// The point of impact.
+	Point vect.Vect
+	// The normal of the surface hit.
+	Normal vect.Vect
+	// The normalized distance along the query segment in the range [0, 1].
+	T vect.Float
+}
+
+// Result of a nearest point query against a shape.
+type NearestPointQueryInfo struct {
+	// The nearest shape, nil if no shape was nearby.
+	Shape *Shape
+	// The closest point on the shape's surface.
+	Point vect.Vect
+	// The distance to the point, negative if the query point is inside the shape.
+	Distance vect.Float
+	// The gradient of the signed distance function.
+	Gradient vect.Vect
+}
+
+// Distance under which the gradient of a nearest point query is not reliable.
+const magicEpsilon = 1e-5
+
 func newShape() *Shape {
 	return &Shape{velocityIndexed: true, e: 0.5, u: 0.5, Layer: -1}
 
@@ -70,6 +101,45 @@ func (shape *Shape) SetElasticity(e vect.Float) {
 	shape.e = e
 }
 
+// Sets the mass of the shape, clearing its density, and updates the mass of its body.
+func (shape *Shape) SetMass(mass vect.Float) {
+	if mass < 0 {
+		panic("Mass must be positive or zero.")
+	}
+
+	shape.mass, shape.density = mass, 0
+	shape.updateBodyMass()
+}
+
+// Sets the density of the shape, so its mass follows its area, and updates the mass of its body.
+func (shape *Shape) SetDensity(density vect.Float) {
+	if density < 0 {
+		panic("Density must be positive or zero.")
+	}
+
+	shape.mass, shape.density = 0, density
+	shape.updateBodyMass()
+}
+
+// Returns the mass of the shape, computed from the area if a density was set.
+func (shape *Shape) Mass() vect.Float {
+	if shape.density != 0 {
+		return shape.density * shape.ShapeClass.Area()
+	}
+	return shape.mass
+}
+
+// Returns the density of the shape, zero if its mass was set with SetMass.
+func (shape *Shape) Density() vect.Float {
+	return shape.density
+}
+
+func (shape *Shape) updateBodyMass() {
+	if shape.Body != nil && shape.ShapeClass != nil {
+		shape.Body.UpdateMass()
+	}
+}
+
 func (shape *Shape) Shape() *Shape {
 	return shape
 }
@@ -90,5 +160,29 @@ func (shape *Shape) Clone() *Shape {
 
 func (shape *Shape) Update() {
 	//fmt.Println("Rot", shape.Body.rot)
-	shape.BB = shape.ShapeClass.update(transform.NewTransform(shape.Body.p, shape.Body.a))
+	shape.BB = shape.ShapeClass.update(shape.Body.transform())
+}
+
+// Performs a segment query from a to b against the shape.
+// Returns true and fills info if the segment hits the shape.
+func (shape *Shape) SegmentQuery(a, b vect.Vect, info *SegmentQueryInfo) bool {
+	hit := SegmentQueryInfo{T: 1}
+	shape.ShapeClass.segmentQuery(a, b, &hit)
+	if hit.Shape == nil {
+		return false
+	}
+
+	hit.Shape = shape
+	hit.Point = vect.Add(a, vect.Mult(vect.Sub(b, a), hit.T))
+	if info != nil {
+		*info = hit
+	}
+	return true
+}
+
+// Returns the point on the shape's surface closest to p along with the signed distance to it.
+func (shape *Shape) NearestPointQuery(p vect.Vect) NearestPointQueryInfo {
+	info := shape.ShapeClass.nearestPointQuery(p)
+	info.Shape = shape
+	return info
 }
@@ -37,12 +37,25 @@ type ShapeClass interface {
 	update(xf transform.Transform) AABB
 	// Returns if the given point is located inside the shape.
 	TestPoint(point vect.Vect) bool
+	// Tests the segment from a to b against the transformed shape, info is only written on a hit.
+	segmentQuery(a, b vect.Vect, info *SegmentQueryInfo)
+	// Finds the point on the transformed shape's surface closest to p.
+	nearestPointQuery(p vect.Vect) NearestPointQueryInfo
 
-	Moment(mass float32) vect.Float
+	// Returns the moment of inertia of the shape about the body's origin for the given mass.
+	Moment(mass vect.Float) vect.Float
+	// Returns the area of the shape.
+	Area() vect.Float
+	// Returns the center of gravity of the shape in body coordinates.
+	Centroid() vect.Vect
+	// Returns the moment of inertia of the shape about its centroid for the given mass.
+	centroidMoment(mass vect.Float) vect.Float
 
 	Clone(s *Shape) ShapeClass
-	//marshalShape(shape *Shape) ([]byte, error)
-	//unmarshalShape(shape *Shape, data []byte) error
+	// Encodes the shape class specific data.
+	marshalShape(shape *Shape) ([]byte, error)
+	// Decodes data written by marshalShape and attaches the class to shape.
+	unmarshalShape(shape *Shape, data []byte) error
 }
 
 // Returns shape.ShapeClass as CircleShape or nil.
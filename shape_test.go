@@ -0,0 +1,174 @@
+package chipmunk
+
+import (
+	"math"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Attaches the shape to a static body at pos rotated by angle and updates it.
+func placeShape(shape *Shape, pos vect.Vect, angle vect.Float) *Shape {
+	body := NewBodyStatic()
+	body.SetPosition(pos)
+	body.SetAngle(angle)
+	body.AddShape(shape)
+	shape.Update()
+	return shape
+}
+
+func nearlyEqualVect(a, b vect.Vect) bool {
+	return nearlyEqual(a.X, b.X) && nearlyEqual(a.Y, b.Y)
+}
+
+type segmentQueryCase struct {
+	name   string
+	shape  *Shape
+	a, b   vect.Vect
+	hit    bool
+	t      vect.Float
+	normal vect.Vect
+}
+
+func TestShapeSegmentQuery(t *testing.T) {
+	circle := placeShape(NewCircle(vect.Vector_Zero, 2), vect.Vect{10, 0}, 0)
+	segment := placeShape(NewSegment(vect.Vect{-5, 0}, vect.Vect{5, 0}, 1), vect.Vector_Zero, 0)
+	thin := placeShape(NewSegment(vect.Vect{-5, 0}, vect.Vect{5, 0}, 0), vect.Vector_Zero, 0)
+	// A 2x6 box turned on its side is 6 wide.
+	box := placeShape(NewBox(vect.Vector_Zero, 2, 6), vect.Vect{10, 0}, math.Pi/2)
+	triangle := placeShape(NewPolygon(Vertices{{0, 0}, {0, 4}, {4, 0}}, vect.Vector_Zero), vect.Vect{1, 1}, 0)
+
+	capX := vect.Float(math.Sqrt(0.75))
+	diagonal := vect.Float(math.Sqrt(0.5))
+
+	cases := []segmentQueryCase{
+		{"circle", circle, vect.Vect{0, 0}, vect.Vect{20, 0}, true, 0.4, vect.Vect{-1, 0}},
+		{"circle reversed", circle, vect.Vect{20, 0}, vect.Vect{0, 0}, true, 0.4, vect.Vect{1, 0}},
+		{"circle missed", circle, vect.Vect{0, 3}, vect.Vect{20, 3}, false, 0, vect.Vect{}},
+		{"circle too short", circle, vect.Vect{0, 0}, vect.Vect{7, 0}, false, 0, vect.Vect{}},
+		{"circle from inside", circle, vect.Vect{10, 0}, vect.Vect{20, 0}, false, 0, vect.Vect{}},
+
+		{"segment from above", segment, vect.Vect{0, 10}, vect.Vect{0, -10}, true, 0.45, vect.Vect{0, 1}},
+		{"segment from below", segment, vect.Vect{2, -10}, vect.Vect{2, 10}, true, 0.45, vect.Vect{0, -1}},
+		{"segment cap", segment, vect.Vect{-10, 0.5}, vect.Vect{10, 0.5}, true, (10 - 5 - capX) / 20, vect.Vect{-capX, 0.5}},
+		{"segment past the cap", segment, vect.Vect{-10, 1.5}, vect.Vect{10, 1.5}, false, 0, vect.Vect{}},
+		{"thin segment", thin, vect.Vect{1, 10}, vect.Vect{1, -10}, true, 0.5, vect.Vect{0, 1}},
+		{"thin segment past the end", thin, vect.Vect{6, 10}, vect.Vect{6, -10}, false, 0, vect.Vect{}},
+
+		{"box", box, vect.Vect{0, 0}, vect.Vect{20, 0}, true, 0.35, vect.Vect{-1, 0}},
+		{"box from above", box, vect.Vect{10, 10}, vect.Vect{10, -10}, true, 0.45, vect.Vect{0, 1}},
+		{"box missed", box, vect.Vect{0, 2}, vect.Vect{20, 2}, false, 0, vect.Vect{}},
+
+		{"polygon", triangle, vect.Vect{11, 11}, vect.Vect{1, 1}, true, 0.8, vect.Vect{diagonal, diagonal}},
+		{"polygon side", triangle, vect.Vect{-9, 2}, vect.Vect{11, 2}, true, 0.5, vect.Vect{-1, 0}},
+		{"polygon missed", triangle, vect.Vect{-9, 6}, vect.Vect{11, 6}, false, 0, vect.Vect{}},
+	}
+
+	for _, c := range cases {
+		var info SegmentQueryInfo
+		hit := c.shape.SegmentQuery(c.a, c.b, &info)
+		if hit != c.hit {
+			t.Errorf("%s: hit is %v, want %v", c.name, hit, c.hit)
+			continue
+		}
+		if !hit {
+			continue
+		}
+		if info.Shape != c.shape || !nearlyEqual(info.T, c.t) || !nearlyEqualVect(info.Normal, c.normal) {
+			t.Errorf("%s: hit %v at %v with normal %v, want %v with normal %v", c.name, info.Shape == c.shape, info.T, info.Normal, c.t, c.normal)
+		}
+		if point := vect.Add(c.a, vect.Mult(vect.Sub(c.b, c.a), c.t)); !nearlyEqualVect(info.Point, point) {
+			t.Errorf("%s: hit point is %v, want %v", c.name, info.Point, point)
+		}
+	}
+}
+
+func TestShapeTestPoint(t *testing.T) {
+	circle := placeShape(NewCircle(vect.Vector_Zero, 2), vect.Vect{10, 0}, 0)
+	segment := placeShape(NewSegment(vect.Vect{-5, 0}, vect.Vect{5, 0}, 1), vect.Vector_Zero, 0)
+	thin := placeShape(NewSegment(vect.Vect{-5, 0}, vect.Vect{5, 0}, 0), vect.Vector_Zero, 0)
+	box := placeShape(NewBox(vect.Vector_Zero, 2, 6), vect.Vect{10, 0}, 0)
+	turned := placeShape(NewBox(vect.Vector_Zero, 2, 6), vect.Vect{10, 0}, math.Pi/2)
+	triangle := placeShape(NewPolygon(Vertices{{0, 0}, {0, 4}, {4, 0}}, vect.Vector_Zero), vect.Vect{1, 1}, 0)
+
+	cases := []struct {
+		name   string
+		shape  *Shape
+		point  vect.Vect
+		inside bool
+	}{
+		{"circle center", circle, vect.Vect{10, 0}, true},
+		{"circle inside", circle, vect.Vect{11, 1}, true},
+		{"circle edge", circle, vect.Vect{12, 0}, true},
+		{"circle outside", circle, vect.Vect{11.5, 1.5}, false},
+
+		{"segment middle", segment, vect.Vect{2, 0.5}, true},
+		{"segment edge", segment, vect.Vect{0, -1}, true},
+		{"segment cap", segment, vect.Vect{5.5, 0.5}, true},
+		{"segment cap edge", segment, vect.Vect{6, 0}, true},
+		{"segment outside", segment, vect.Vect{0, 1.5}, false},
+		{"segment past the cap", segment, vect.Vect{5.8, 0.8}, false},
+		{"thin segment on it", thin, vect.Vect{2, 0}, true},
+		{"thin segment beside it", thin, vect.Vect{2, 0.1}, false},
+
+		{"box inside", box, vect.Vect{10.5, 2.5}, true},
+		{"box edge", box, vect.Vect{11, 0}, true},
+		{"box corner", box, vect.Vect{9, -3}, true},
+		{"box outside", box, vect.Vect{11.5, 0}, false},
+		{"turned box inside", turned, vect.Vect{12.5, 0.5}, true},
+		{"turned box outside", turned, vect.Vect{10.5, 2.5}, false},
+
+		{"polygon inside", triangle, vect.Vect{2, 2}, true},
+		{"polygon edge", triangle, vect.Vect{1, 2}, true},
+		{"polygon outside", triangle, vect.Vect{3.5, 3.5}, false},
+		{"polygon left of it", triangle, vect.Vect{0.5, 2}, false},
+	}
+
+	for _, c := range cases {
+		if inside := c.shape.TestPoint(c.point); inside != c.inside {
+			t.Errorf("%s: TestPoint(%v) is %v, want %v", c.name, c.point, inside, c.inside)
+		}
+	}
+}
+
+func TestShapeNearestPointQuery(t *testing.T) {
+	circle := placeShape(NewCircle(vect.Vector_Zero, 2), vect.Vect{10, 0}, 0)
+	segment := placeShape(NewSegment(vect.Vect{-5, 0}, vect.Vect{5, 0}, 1), vect.Vector_Zero, 0)
+	box := placeShape(NewBox(vect.Vector_Zero, 2, 6), vect.Vect{10, 0}, 0)
+	triangle := placeShape(NewPolygon(Vertices{{0, 0}, {0, 4}, {4, 0}}, vect.Vector_Zero), vect.Vect{1, 1}, 0)
+
+	diagonal := vect.Float(math.Sqrt(0.5))
+
+	// The gradient points away from the shape, inside the shape too.
+	cases := []struct {
+		name     string
+		shape    *Shape
+		p        vect.Vect
+		distance vect.Float
+		point    vect.Vect
+		gradient vect.Vect
+	}{
+		{"circle outside", circle, vect.Vect{14, 0}, 2, vect.Vect{12, 0}, vect.Vect{1, 0}},
+		{"circle inside", circle, vect.Vect{10, 1}, -1, vect.Vect{10, 2}, vect.Vect{0, 1}},
+		{"circle center", circle, vect.Vect{10, 0}, -2, vect.Vect{10, 2}, vect.Vect{0, 1}},
+
+		{"segment outside", segment, vect.Vect{0, 3}, 2, vect.Vect{0, 1}, vect.Vect{0, 1}},
+		{"segment inside", segment, vect.Vect{0, -0.5}, -0.5, vect.Vect{0, -1}, vect.Vect{0, -1}},
+		{"segment cap", segment, vect.Vect{8, 0}, 2, vect.Vect{6, 0}, vect.Vect{1, 0}},
+
+		{"box outside", box, vect.Vect{13, 0}, 2, vect.Vect{11, 0}, vect.Vect{1, 0}},
+		{"box inside", box, vect.Vect{10.5, 0}, -0.5, vect.Vect{11, 0}, vect.Vect{1, 0}},
+		{"box corner", box, vect.Vect{12, 4}, vect.Float(math.Sqrt(2)), vect.Vect{11, 3}, vect.Vect{diagonal, diagonal}},
+
+		{"polygon outside", triangle, vect.Vect{0, 2}, 1, vect.Vect{1, 2}, vect.Vect{-1, 0}},
+		{"polygon inside", triangle, vect.Vect{2, 1.5}, -0.5, vect.Vect{2, 1}, vect.Vect{0, -1}},
+	}
+
+	for _, c := range cases {
+		info := c.shape.NearestPointQuery(c.p)
+		if info.Shape != c.shape || !nearlyEqual(info.Distance, c.distance) || !nearlyEqualVect(info.Point, c.point) || !nearlyEqualVect(info.Gradient, c.gradient) {
+			t.Errorf("%s: nearest point %v at %v with gradient %v, want %v at %v with gradient %v",
+				c.name, info.Point, info.Distance, info.Gradient, c.point, c.distance, c.gradient)
+		}
+	}
+}
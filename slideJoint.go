@@ -0,0 +1,89 @@
+package chipmunk
+
+import (
+	"github.com/vova616/chipmunk/transform"
+	"github.com/vova616/chipmunk/vect"
+)
+
+// SlideJoint keeps the anchor points of two bodies between a minimum and maximum distance.
+type SlideJoint struct {
+	BasicConstraint
+	Anchor1, Anchor2 vect.Vect
+	Min, Max         vect.Float
+
+	r1, r2 vect.Vect
+	n      vect.Vect
+	nMass  vect.Float
+
+	jnAcc, jnMax vect.Float
+	bias         vect.Float
+}
+
+func NewSlideJoint(a, b *Body, anchor1, anchor2 vect.Vect, min, max vect.Float) *SlideJoint {
+	return &SlideJoint{
+		BasicConstraint: NewConstraint(a, b),
+		Anchor1:         anchor1,
+		Anchor2:         anchor2,
+		Min:             min,
+		Max:             max,
+	}
+}
+
+func (this *SlideJoint) PreStep(dt vect.Float) {
+	a, b := this.BodyA, this.BodyB
+
+	this.r1 = transform.RotateVect(vect.Sub(this.Anchor1, a.cog), transform.Rotation{a.rot.X, a.rot.Y})
+	this.r2 = transform.RotateVect(vect.Sub(this.Anchor2, b.cog), transform.Rotation{b.rot.X, b.rot.Y})
+
+	delta := vect.Sub(vect.Add(b.p, this.r2), vect.Add(a.p, this.r1))
+	dist := vect.Length(delta)
+	pdist := vect.Float(0)
+	if dist > this.Max {
+		pdist = dist - this.Max
+		this.n = vect.Mult(delta, 1/dist)
+	} else if dist < this.Min && dist != 0 {
+		pdist = this.Min - dist
+		this.n = vect.Mult(delta, -1/dist)
+	} else {
+		this.n = vect.Vector_Zero
+		this.jnAcc = 0
+	}
+
+	// calculate mass normal
+	this.nMass = 1.0 / k_scalar(a, b, this.r1, this.r2, this.n)
+
+	// compute max impulse
+	this.jnMax = this.MaxForce * dt
+
+	// calculate bias velocity
+	this.bias = vect.FClamp(-bias_coef(this.ErrorBias, dt)*pdist/dt, -this.MaxBias, this.MaxBias)
+}
+
+func (this *SlideJoint) ApplyCachedImpulse(dt_coef vect.Float) {
+	apply_impulses(this.BodyA, this.BodyB, this.r1, this.r2, vect.Mult(this.n, this.jnAcc*dt_coef))
+}
+
+func (this *SlideJoint) ApplyImpulse() {
+	if vect.Equals(this.n, vect.Vector_Zero) {
+		return // early exit
+	}
+
+	a, b := this.BodyA, this.BodyB
+	n := this.n
+
+	// compute relative velocity
+	vrn := normal_relative_velocity(a, b, this.r1, this.r2, n)
+
+	// compute normal impulse
+	jn := (this.bias - vrn) * this.nMass
+	jnOld := this.jnAcc
+	this.jnAcc = vect.FClamp(jnOld+jn, -this.jnMax, 0)
+	jn = this.jnAcc - jnOld
+
+	// apply impulse
+	apply_impulses(a, b, this.r1, this.r2, vect.Mult(n, jn))
+}
+
+func (this *SlideJoint) Impulse() vect.Float {
+	return vect.FAbs(this.jnAcc)
+}
@@ -0,0 +1,439 @@
+package chipmunk
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Snapshot holds a copy of the state of a space, see Space.Snapshot.
+type Snapshot struct {
+	iterations           int
+	gravity              vect.Vect
+	damping              vect.Float
+	idleSpeedThreshold   vect.Float
+	sleepTimeThreshold   vect.Float
+	collisionSlop        vect.Float
+	collisionBias        vect.Float
+	collisionPersistence int64
+	enableContactGraph   bool
+	curr_dt              vect.Float
+	stamp                time.Duration
+
+	bodies             []*Body
+	sleepingComponents []*Body
+	deleteBodies       []*Body
+	constraints        []Constraint
+	arbiters           []int
+	cachedArbiters     []int
+
+	bodyStates       map[*Body]*bodySnapshot
+	shapeStates      map[*Shape]Shape
+	constraintStates map[Constraint]reflect.Value
+	arbiterStates    []arbiterSnapshot
+
+	staticShapes, activeShapes *SpatialIndex
+	// treeSnapshot, hashSnapshot or sweepSnapshot depending on the class of the index.
+	staticIndex, activeIndex interface{}
+}
+
+type bodySnapshot struct {
+	body        Body
+	shapes      []*Shape
+	constraints []Constraint
+	arbiters    []int
+}
+
+type arbiterSnapshot struct {
+	arb      Arbiter
+	contacts []Contact
+}
+
+type treeSnapshot struct {
+	root      *Node
+	leaves    HashSet
+	leafOrder []*Node
+	stamp     time.Duration
+}
+
+type sweepSnapshot struct {
+	table []*Node
+	cells HashSet
+}
+
+type hashSnapshot struct {
+	numCells    int
+	cellDim     vect.Float
+	table       []*spaceHashBin
+	handles     HashSet
+	handleOrder []*Node
+	stamp       time.Duration
+}
+
+// Captures everything that affects the next Step: the space settings and timing, the bodies including
+// their bias velocities, the shapes, the constraints with their accumulated impulses, the cached arbiters
+// with their contacts and the layout of the spatial indexes. The snapshot can be restored any number of times.
+// Stepping a restored space gives bit-identical results to stepping the original.
+// Changes to the geometry of the shapes (radius, vertices...) are not captured.
+func (space *Space) Snapshot() *Snapshot {
+	space.assertUnlocked()
+
+	snapshot := &Snapshot{
+		iterations:           space.Iterations,
+		gravity:              space.Gravity,
+		damping:              space.damping,
+		idleSpeedThreshold:   space.idleSpeedThreshold,
+		sleepTimeThreshold:   space.sleepTimeThreshold,
+		collisionSlop:        space.collisionSlop,
+		collisionBias:        space.collisionBias,
+		collisionPersistence: space.collisionPersistence,
+		enableContactGraph:   space.enableContactGraph,
+		curr_dt:              space.curr_dt,
+		stamp:                space.stamp,
+
+		bodies:             append([]*Body(nil), space.Bodies...),
+		sleepingComponents: append([]*Body(nil), space.sleepingComponents...),
+		deleteBodies:       append([]*Body(nil), space.deleteBodies...),
+		constraints:        append([]Constraint(nil), space.Constraints...),
+
+		bodyStates:       make(map[*Body]*bodySnapshot),
+		shapeStates:      make(map[*Shape]Shape),
+		constraintStates: make(map[Constraint]reflect.Value),
+	}
+
+	arbiterIndexes := make(map[*Arbiter]int)
+	saveArbiter := func(arb *Arbiter) int {
+		if i, ok := arbiterIndexes[arb]; ok {
+			return i
+		}
+
+		state := arbiterSnapshot{arb: *arb}
+		if arb.Contacts != nil {
+			state.contacts = make([]Contact, len(arb.Contacts))
+			for i, con := range arb.Contacts {
+				state.contacts[i] = *con
+			}
+		}
+
+		i := len(snapshot.arbiterStates)
+		arbiterIndexes[arb] = i
+		snapshot.arbiterStates = append(snapshot.arbiterStates, state)
+		return i
+	}
+
+	var saveBody func(body *Body)
+	saveConstraint := func(constraint Constraint) {
+		if _, ok := snapshot.constraintStates[constraint]; ok {
+			return
+		}
+
+		value := reflect.ValueOf(constraint).Elem()
+		state := reflect.New(value.Type()).Elem()
+		state.Set(value)
+		snapshot.constraintStates[constraint] = state
+
+		con := constraint.Constraint()
+		saveBody(con.BodyA)
+		saveBody(con.BodyB)
+	}
+
+	saveBody = func(body *Body) {
+		if body == nil || snapshot.bodyStates[body] != nil {
+			return
+		}
+
+		state := &bodySnapshot{
+			body:        *body,
+			shapes:      append([]*Shape(nil), body.Shapes...),
+			constraints: append([]Constraint(nil), body.constraints...),
+		}
+		snapshot.bodyStates[body] = state
+
+		for _, shape := range body.Shapes {
+			snapshot.shapeStates[shape] = *shape
+		}
+		for _, constraint := range body.constraints {
+			saveConstraint(constraint)
+		}
+		for _, arb := range body.arbiters {
+			state.arbiters = append(state.arbiters, saveArbiter(arb))
+		}
+	}
+
+	for _, body := range space.allBodies() {
+		saveBody(body)
+	}
+	for _, body := range space.deleteBodies {
+		saveBody(body)
+	}
+	for _, index := range []*SpatialIndex{space.staticShapes, space.activeShapes} {
+		index.Each(func(node *Node) {
+			shape := node.obj.Shape()
+			snapshot.shapeStates[shape] = *shape
+			saveBody(shape.Body)
+		})
+	}
+	for _, constraint := range space.Constraints {
+		saveConstraint(constraint)
+	}
+
+	for _, arb := range space.cachedArbitersOrder {
+		snapshot.cachedArbiters = append(snapshot.cachedArbiters, saveArbiter(arb))
+	}
+	for _, arb := range space.Arbiters {
+		snapshot.arbiters = append(snapshot.arbiters, saveArbiter(arb))
+	}
+	for _, state := range snapshot.arbiterStates {
+		saveBody(state.arb.BodyA)
+		saveBody(state.arb.BodyB)
+	}
+
+	copier := newNodeCopier()
+	snapshot.staticShapes = space.staticShapes
+	snapshot.activeShapes = space.activeShapes
+	snapshot.staticIndex = copier.copyIndex(snapshotIndex(space.staticShapes))
+	snapshot.activeIndex = copier.copyIndex(snapshotIndex(space.activeShapes))
+
+	return snapshot
+}
+
+// Restores the space to the state captured by Snapshot.
+// Bodies, shapes and constraints added after the snapshot was taken are removed from the space.
+func (space *Space) Restore(snapshot *Snapshot) {
+	space.assertUnlocked()
+
+	// Detach everything that didn't exist when the snapshot was taken.
+	for _, body := range space.allBodies() {
+		if snapshot.bodyStates[body] == nil {
+			for _, shape := range body.Shapes {
+				shape.space = nil
+			}
+			body.space = nil
+		}
+	}
+	for _, constraint := range space.Constraints {
+		if _, ok := snapshot.constraintStates[constraint]; !ok {
+			constraint.Constraint().space = nil
+		}
+	}
+
+	arbiters := make([]*Arbiter, len(snapshot.arbiterStates))
+	for i, state := range snapshot.arbiterStates {
+		arb := newArbiter()
+		*arb = state.arb
+		if state.contacts != nil {
+			contacts := make([]*Contact, MaxPoints)
+			for j := range contacts {
+				contacts[j] = &Contact{}
+				if j < len(state.contacts) {
+					*contacts[j] = state.contacts[j]
+				}
+			}
+			arb.Contacts = contacts[:len(state.contacts)]
+		}
+		arbiters[i] = arb
+	}
+
+	for body, state := range snapshot.bodyStates {
+		*body = state.body
+		body.Shapes = append([]*Shape(nil), state.shapes...)
+		body.constraints = append([]Constraint(nil), state.constraints...)
+		body.arbiters = make([]*Arbiter, len(state.arbiters))
+		for i, index := range state.arbiters {
+			body.arbiters[i] = arbiters[index]
+		}
+	}
+
+	for shape, state := range snapshot.shapeStates {
+		*shape = state
+		// Recalculate the transformed geometry, the bounding box is kept as it was.
+		if shape.Body != nil && shape.ShapeClass != nil {
+			shape.ShapeClass.update(shape.Body.transform())
+		}
+	}
+
+	for constraint, state := range snapshot.constraintStates {
+		reflect.ValueOf(constraint).Elem().Set(state)
+	}
+
+	space.Iterations = snapshot.iterations
+	space.Gravity = snapshot.gravity
+	space.damping = snapshot.damping
+	space.idleSpeedThreshold = snapshot.idleSpeedThreshold
+	space.sleepTimeThreshold = snapshot.sleepTimeThreshold
+	space.collisionSlop = snapshot.collisionSlop
+	space.collisionBias = snapshot.collisionBias
+	space.collisionPersistence = snapshot.collisionPersistence
+	space.enableContactGraph = snapshot.enableContactGraph
+	space.curr_dt = snapshot.curr_dt
+	space.stamp = snapshot.stamp
+
+	space.Bodies = append(space.Bodies[0:0], snapshot.bodies...)
+	space.sleepingComponents = append(space.sleepingComponents[0:0], snapshot.sleepingComponents...)
+	space.deleteBodies = append(space.deleteBodies[0:0], snapshot.deleteBodies...)
+	space.Constraints = append(space.Constraints[0:0], snapshot.constraints...)
+
+	space.cachedArbiters = make(map[HashPair]*Arbiter, len(snapshot.cachedArbiters))
+	space.cachedArbitersOrder = space.cachedArbitersOrder[0:0]
+	for _, index := range snapshot.cachedArbiters {
+		arb := arbiters[index]
+		space.cacheArbiter(newPair(arb.ShapeA, arb.ShapeB), arb)
+	}
+	space.Arbiters = space.Arbiters[0:0]
+	for _, index := range snapshot.arbiters {
+		space.Arbiters = append(space.Arbiters, arbiters[index])
+	}
+
+	// The indexes may have been switched since the snapshot was taken.
+	space.staticShapes = snapshot.staticShapes
+	space.activeShapes = snapshot.activeShapes
+
+	copier := newNodeCopier()
+	restoreIndex(space.staticShapes, copier.copyIndex(snapshot.staticIndex))
+	restoreIndex(space.activeShapes, copier.copyIndex(snapshot.activeIndex))
+}
+
+func snapshotIndex(index *SpatialIndex) interface{} {
+	switch class := index.SpatialIndexClass.(type) {
+	case *BBTree:
+		return treeSnapshot{class.root, class.leaves, class.leafOrder, class.stamp}
+	case *SpaceHash:
+		return hashSnapshot{class.numCells, class.cellDim, class.table, class.handles, class.handleOrder, class.stamp}
+	case *Sweep1D:
+		return sweepSnapshot{class.table, class.cells}
+	}
+	panic("Snapshot is only supported with BBTree, SpaceHash and Sweep1D spatial indexes.")
+}
+
+func restoreIndex(index *SpatialIndex, state interface{}) {
+	switch class := index.SpatialIndexClass.(type) {
+	case *BBTree:
+		state := state.(treeSnapshot)
+		class.root = state.root
+		class.leaves = state.leaves
+		class.leafOrder = state.leafOrder
+		class.stamp = state.stamp
+	case *SpaceHash:
+		state := state.(hashSnapshot)
+		class.numCells = state.numCells
+		class.cellDim = state.cellDim
+		class.table = state.table
+		class.handles = state.handles
+		class.handleOrder = state.handleOrder
+		class.stamp = state.stamp
+	case *Sweep1D:
+		state := state.(sweepSnapshot)
+		class.table = state.table
+		class.cells = state.cells
+	}
+}
+
+// Deep copies the nodes and pairs of the trees, pairs link the leaves of the static and the active tree
+// so both trees have to be copied by the same copier.
+type nodeCopier struct {
+	nodes map[*Node]*Node
+	pairs map[*Pair]*Pair
+}
+
+func newNodeCopier() *nodeCopier {
+	return &nodeCopier{make(map[*Node]*Node), make(map[*Pair]*Pair)}
+}
+
+func (copier *nodeCopier) copyIndex(state interface{}) interface{} {
+	switch state := state.(type) {
+	case treeSnapshot:
+		return copier.copyTree(state)
+	case hashSnapshot:
+		return copier.copyHash(state)
+	case sweepSnapshot:
+		return copier.copySweep(state)
+	}
+	panic("Unknown spatial index snapshot.")
+}
+
+func (copier *nodeCopier) copyHash(state hashSnapshot) hashSnapshot {
+	handles := make(HashSet, len(state.handles))
+	for hash, hand := range state.handles {
+		handles[hash] = copier.copyNode(hand)
+	}
+	handleOrder := make([]*Node, len(state.handleOrder))
+	for i, hand := range state.handleOrder {
+		handleOrder[i] = copier.copyNode(hand)
+	}
+
+	table := make([]*spaceHashBin, len(state.table))
+	for i, bin := range state.table {
+		for binPtr := &table[i]; bin != nil; bin = bin.next {
+			*binPtr = &spaceHashBin{handle: copier.copyNode(bin.handle)}
+			binPtr = &(*binPtr).next
+		}
+	}
+
+	return hashSnapshot{state.numCells, state.cellDim, table, handles, handleOrder, state.stamp}
+}
+
+func (copier *nodeCopier) copySweep(state sweepSnapshot) sweepSnapshot {
+	cells := make(HashSet, len(state.cells))
+	for hash, cell := range state.cells {
+		cells[hash] = copier.copyNode(cell)
+	}
+	table := make([]*Node, len(state.table))
+	for i, cell := range state.table {
+		table[i] = copier.copyNode(cell)
+	}
+	return sweepSnapshot{table, cells}
+}
+
+func (copier *nodeCopier) copyTree(state treeSnapshot) treeSnapshot {
+	leaves := make(HashSet, len(state.leaves))
+	for hash, leaf := range state.leaves {
+		leaves[hash] = copier.copyNode(leaf)
+	}
+	leafOrder := make([]*Node, len(state.leafOrder))
+	for i, leaf := range state.leafOrder {
+		leafOrder[i] = copier.copyNode(leaf)
+	}
+	return treeSnapshot{copier.copyNode(state.root), leaves, leafOrder, state.stamp}
+}
+
+func (copier *nodeCopier) copyNode(node *Node) *Node {
+	if node == nil {
+		return nil
+	}
+	if c, ok := copier.nodes[node]; ok {
+		return c
+	}
+
+	c := &Node{}
+	copier.nodes[node] = c
+	*c = *node
+	c.parent = copier.copyNode(node.parent)
+	c.A = copier.copyNode(node.A)
+	c.B = copier.copyNode(node.B)
+	c.pairs = copier.copyPair(node.pairs)
+	return c
+}
+
+func (copier *nodeCopier) copyPair(pair *Pair) *Pair {
+	if pair == nil {
+		return nil
+	}
+	if c, ok := copier.pairs[pair]; ok {
+		return c
+	}
+
+	c := &Pair{}
+	copier.pairs[pair] = c
+	c.a = copier.copyThread(pair.a)
+	c.b = copier.copyThread(pair.b)
+	return c
+}
+
+func (copier *nodeCopier) copyThread(thread Thread) Thread {
+	return Thread{
+		prev: copier.copyPair(thread.prev),
+		leaf: copier.copyNode(thread.leaf),
+		next: copier.copyPair(thread.next),
+	}
+}
@@ -0,0 +1,92 @@
+package chipmunk
+
+import (
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Circles and boxes dropped in a box, two of them pinned together and sleeping enabled.
+// Returns the dynamic bodies in the order they were added.
+func dropScene() (*Space, []*Body) {
+	space := NewSpace()
+	space.Gravity = vect.Vect{0, -100}
+	space.SetSleepTimeThreshold(0.5)
+
+	ground := NewBodyStatic()
+	ground.AddShape(NewSegment(vect.Vect{-100, 0}, vect.Vect{100, 0}, 1))
+	ground.AddShape(NewSegment(vect.Vect{-100, 0}, vect.Vect{-100, 100}, 1))
+	ground.AddShape(NewSegment(vect.Vect{100, 0}, vect.Vect{100, 100}, 1))
+	space.AddBody(ground)
+
+	var bodies []*Body
+	for i := 0; i < 60; i++ {
+		shape := NewCircle(vect.Vector_Zero, 2)
+		if i%2 == 1 {
+			shape = NewBox(vect.Vector_Zero, 4, 4)
+		}
+		body := NewBody(1, shape.Moment(1))
+		body.SetPosition(vect.Vect{vect.Float(i%10)*9 - 40 + vect.Float(i/10), vect.Float(5 + (i/10)*6)})
+		body.SetAngle(vect.Float(i) * 0.1)
+		body.AddShape(shape)
+		space.AddBody(body)
+		bodies = append(bodies, body)
+	}
+	space.AddConstraint(NewPinJoint(bodies[0], bodies[1], vect.Vector_Zero, vect.Vector_Zero))
+
+	return space, bodies
+}
+
+type bodyState struct {
+	p, v vect.Vect
+	a, w vect.Float
+}
+
+func bodyStates(bodies []*Body) []bodyState {
+	states := make([]bodyState, len(bodies))
+	for i, body := range bodies {
+		states[i] = bodyState{body.p, body.v, body.a, body.w}
+	}
+	return states
+}
+
+func compareStates(t *testing.T, name string, got, want []bodyState) {
+	if len(got) != len(want) {
+		t.Fatalf("%s: %d bodies, want %d", name, len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: body %d is %+v, want %+v", name, i, got[i], want[i])
+		}
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	space, bodies := dropScene()
+	for i := 0; i < 120; i++ {
+		space.Step(1.0 / 60)
+	}
+
+	snapshot := space.Snapshot()
+	atSnapshot := bodyStates(bodies)
+	for i := 0; i < 120; i++ {
+		space.Step(1.0 / 60)
+	}
+	after := bodyStates(bodies)
+
+	// The snapshot can be restored several times, even after adding a body.
+	for k := 0; k < 2; k++ {
+		if k == 1 {
+			extra := NewBody(1, 1)
+			extra.AddShape(NewCircle(vect.Vector_Zero, 2))
+			space.AddBody(extra)
+		}
+
+		space.Restore(snapshot)
+		compareStates(t, "restored", bodyStates(bodies), atSnapshot)
+		for i := 0; i < 120; i++ {
+			space.Step(1.0 / 60)
+		}
+		compareStates(t, "stepped after restore", bodyStates(bodies), after)
+	}
+}
@@ -0,0 +1,165 @@
+package chipmunk
+
+import (
+	"math/bits"
+)
+
+// Scenes with fewer arbiters and constraints are solved serially, synchronizing the workers would cost more than it saves.
+const solverMinParallel = 256
+
+// Minimum number of arbiters and constraints a worker solves at a time.
+const solverMinChunk = 32
+
+// Maximum number of batches, one per bit of Body.solverWrites.
+const solverMaxBatches = 64
+
+// Arbiters and constraints that don't share a body they write, so they can be solved at the same time in any order.
+type solverBatch struct {
+	arbiters    []*Arbiter
+	constraints []Constraint
+}
+
+func (batch *solverBatch) reset() {
+	batch.arbiters = batch.arbiters[0:0]
+	batch.constraints = batch.constraints[0:0]
+}
+
+func (batch *solverBatch) len() int {
+	return len(batch.arbiters) + len(batch.constraints)
+}
+
+func (batch *solverBatch) applyImpulse() {
+	for _, arb := range batch.arbiters {
+		arb.applyImpulse()
+	}
+
+	for _, con := range batch.constraints {
+		con.ApplyImpulse()
+	}
+}
+
+// Colors the graph of the arbiters and constraints, greedily putting each one into the first batch in which none of
+// the bodies it writes is read or written and none of the bodies it reads is written.
+// Arbiters only read the bodies with infinite mass, so the contacts with the ground don't serialize the batches.
+func (space *Space) buildSolverBatches() {
+	for i := range space.solverBatches {
+		space.solverBatches[i].reset()
+	}
+	space.solverBatches = space.solverBatches[0:0]
+	space.solverRest.reset()
+
+	for _, arb := range space.Arbiters {
+		a, b := arb.BodyA, arb.BodyB
+		writeA, writeB := !a.isImmovable(), !b.isImmovable()
+
+		i := space.solverBatchIndex(solverConflicts(a, writeA) | solverConflicts(b, writeB))
+		if i < 0 {
+			space.solverRest.arbiters = append(space.solverRest.arbiters, arb)
+			continue
+		}
+		batch := &space.solverBatches[i]
+		batch.arbiters = append(batch.arbiters, arb)
+
+		solverMark(a, writeA, i)
+		solverMark(b, writeB, i)
+	}
+
+	for _, con := range space.Constraints {
+		// Constraints write both their bodies, even the ones with infinite mass.
+		c := con.Constraint()
+		a, b := c.BodyA, c.BodyB
+
+		i := space.solverBatchIndex(solverConflicts(a, true) | solverConflicts(b, true))
+		if i < 0 {
+			space.solverRest.constraints = append(space.solverRest.constraints, con)
+			continue
+		}
+		batch := &space.solverBatches[i]
+		batch.constraints = append(batch.constraints, con)
+
+		solverMark(a, true, i)
+		solverMark(b, true, i)
+	}
+
+	// Clear the marks for the next step.
+	for _, arb := range space.Arbiters {
+		arb.BodyA.solverWrites, arb.BodyA.solverReads = 0, 0
+		arb.BodyB.solverWrites, arb.BodyB.solverReads = 0, 0
+	}
+	for _, con := range space.Constraints {
+		c := con.Constraint()
+		c.BodyA.solverWrites, c.BodyA.solverReads = 0, 0
+		c.BodyB.solverWrites, c.BodyB.solverReads = 0, 0
+	}
+}
+
+// Returns the batches a body can't be added to.
+func solverConflicts(body *Body, write bool) uint64 {
+	if write {
+		return body.solverWrites | body.solverReads
+	}
+	return body.solverWrites
+}
+
+func solverMark(body *Body, write bool, batch int) {
+	bit := uint64(1) << uint(batch)
+	if write {
+		body.solverWrites |= bit
+	} else {
+		body.solverReads |= bit
+	}
+}
+
+// Returns the first batch not in conflicts, adding a batch if needed, or -1 if all the batches are taken.
+func (space *Space) solverBatchIndex(conflicts uint64) int {
+	i := bits.TrailingZeros64(^conflicts)
+	if i >= solverMaxBatches {
+		return -1
+	}
+
+	if i == len(space.solverBatches) {
+		if i < cap(space.solverBatches) {
+			space.solverBatches = space.solverBatches[:i+1]
+		} else {
+			space.solverBatches = append(space.solverBatches, solverBatch{})
+		}
+	}
+	return i
+}
+
+// Runs the solver iterations, solving the parts of each batch on the workers.
+func (space *Space) applyImpulsesParallel() {
+	space.buildSolverBatches()
+
+	// The parts of each batch, built once and solved every iteration.
+	var parts [][]solverBatch
+	for i := range space.solverBatches {
+		parts = append(parts, space.solverBatches[i].split(space.workerParts(space.solverBatches[i].len(), solverMinChunk)))
+	}
+
+	for i := 0; i < space.Iterations; i++ {
+		for _, batchParts := range parts {
+			if len(batchParts) == 1 {
+				batchParts[0].applyImpulse()
+				continue
+			}
+			space.workerPool.run(len(batchParts), func(part int) {
+				batchParts[part].applyImpulse()
+			})
+		}
+		space.solverRest.applyImpulse()
+	}
+}
+
+// Splits the batch into parts of about the same size.
+func (batch *solverBatch) split(parts int) []solverBatch {
+	split := make([]solverBatch, parts)
+	arbiters, constraints := batch.arbiters, batch.constraints
+	for i := range split {
+		numArbiters := len(arbiters) / (parts - i)
+		numConstraints := len(constraints) / (parts - i)
+		split[i] = solverBatch{arbiters[:numArbiters], constraints[:numConstraints]}
+		arbiters, constraints = arbiters[numArbiters:], constraints[numConstraints:]
+	}
+	return split
+}
@@ -3,7 +3,6 @@ package chipmunk
 import (
 	"errors"
 	"fmt"
-	"github.com/vova616/chipmunk/transform"
 	"github.com/vova616/chipmunk/vect"
 	//"github.com/davecgh/go-spew/spew"
 	"math"
@@ -69,7 +68,17 @@ type Space struct {
 	activeShapes *SpatialIndex
 
 	cachedArbiters map[HashPair]*Arbiter
-	Arbiters       []*Arbiter
+	// The cached arbiters in a stable order, iterated instead of the map to keep stepping deterministic.
+	cachedArbitersOrder []*Arbiter
+	Arbiters            []*Arbiter
+
+	collisionHandlers map[collisionTypePair]*CollisionHandler
+	wildcardHandlers  map[CollisionType]*CollisionHandler
+
+	locked            int
+	rousedBodies      []*Body
+	postStepCallbacks []postStepCallback
+	skipPostStep      bool
 
 	ArbiterBuffer []*Arbiter
 	ContactBuffer [][]*Contact
@@ -77,6 +86,22 @@ type Space struct {
 	ApplyImpulsesTime time.Duration
 	ReindexQueryTime  time.Duration
 	StepTime          time.Duration
+
+	// Number of shapes reinserted into the active spatial index and of pairs of shapes
+	// passed to the collision detection during the last step.
+	ReindexQueryReinserts int
+	ReindexQueryPairs     int
+
+	// Number of goroutines solving the arbiters and constraints, see SetWorkers.
+	workers    int
+	workerPool *workerPool
+	// Pairs of shapes found by the broad phase waiting for the narrow phase, and the contact buffers of the workers.
+	shapePairs     []shapePair
+	collideWorkers []collideWorker
+	// The arbiters and constraints of the last step split into batches that don't share a body.
+	solverBatches []solverBatch
+	// The arbiters and constraints that didn't fit in a batch, solved serially after the batches.
+	solverRest solverBatch
 }
 
 type ContactBufferHeader struct {
@@ -99,6 +124,8 @@ func NewSpace() (space *Space) {
 
 	space.damping = 1
 
+	space.sleepTimeThreshold = Inf
+
 	space.collisionSlop = 0.5
 	space.collisionBias = vect.Float(math.Pow(1.0-0.1, 60))
 	space.collisionPersistence = 3
@@ -112,6 +139,8 @@ func NewSpace() (space *Space) {
 	space.staticShapes = NewBBTree(nil)
 	space.activeShapes = NewBBTree(space.staticShapes)
 	space.cachedArbiters = make(map[HashPair]*Arbiter)
+	space.collisionHandlers = make(map[collisionTypePair]*CollisionHandler)
+	space.wildcardHandlers = make(map[CollisionType]*CollisionHandler)
 	space.Arbiters = make([]*Arbiter, 0)
 	space.ArbiterBuffer = make([]*Arbiter, ArbiterBufferSize)
 
@@ -129,11 +158,8 @@ func NewSpace() (space *Space) {
 		}
 		space.ContactBuffer[i] = contacts
 	}
-	/*
-		for i := 0; i < 8; i++ {
-			go space.MultiThreadTest()
-		}
-	*/
+
+	space.workers = 1
 	return
 }
 
@@ -143,16 +169,23 @@ func (space *Space) Destory() {
 }
 
 func (space *Space) Destroy() {
+	space.assertUnlocked()
 	space.Bodies = nil
 	space.sleepingComponents = nil
 	space.staticShapes = nil
 	space.activeShapes = nil
 	space.cachedArbiters = nil
+	space.cachedArbitersOrder = nil
 	space.Arbiters = nil
 	space.ArbiterBuffer = nil
 	space.ContactBuffer = nil
+	space.SetWorkers(1)
 }
 
+// Steps the space forward in time by dt.
+// Stepping is deterministic, spaces built and stepped with the same calls in the same order
+// produce bit-identical results and call the collision callbacks in the same order.
+// A callback panicking leaves the step unfinished but the space unlocked.
 func (space *Space) Step(dt vect.Float) {
 
 	// don't step if the timestep is 0!
@@ -160,6 +193,12 @@ func (space *Space) Step(dt vect.Float) {
 		return
 	}
 
+	// Restore the lock when a callback panics, the step unlocks it otherwise.
+	locked := space.locked
+	defer func() {
+		space.locked = locked
+	}()
+
 	stepStart := time.Now()
 
 	bodies := space.Bodies
@@ -170,13 +209,24 @@ func (space *Space) Step(dt vect.Float) {
 
 	space.Arbiters = space.Arbiters[0:0]
 
+	// Reset the contact graph of the awake bodies, sleeping bodies keep theirs.
+	for _, body := range bodies {
+		body.arbiters = body.arbiters[0:0]
+	}
+
 	prev_dt := space.curr_dt
 	space.curr_dt = dt
 
 	space.stamp++
 
+	space.lock()
+
+	var bullets []bulletMotion
 	for _, body := range bodies {
 		if body.Enabled {
+			if body.Bullet {
+				bullets = append(bullets, bulletMotion{body, body.p, body.a})
+			}
 			body.UpdatePosition(dt)
 		}
 	}
@@ -187,18 +237,60 @@ func (space *Space) Step(dt vect.Float) {
 		}
 	}
 
+	if len(bullets) > 0 {
+		space.sweepBullets(bullets)
+	}
+
 	start := time.Now()
-	space.activeShapes.ReindexQuery(func(a, b Indexable) {
-		SpaceCollideShapes(a.Shape(), b.Shape(), space)
-	})
+	if space.workers > 1 {
+		// Collect the pairs first so the narrow phase can run on the workers.
+		space.activeShapes.ReindexQuery(func(a, b Indexable) {
+			space.collectPair(a.Shape(), b.Shape())
+		})
+		space.collidePairs()
+	} else {
+		space.activeShapes.ReindexQuery(func(a, b Indexable) {
+			SpaceCollideShapes(a.Shape(), b.Shape(), space)
+		})
+	}
 	space.ReindexQueryTime = time.Since(start)
 
+	switch index := space.activeShapes.SpatialIndexClass.(type) {
+	case *BBTree:
+		space.ReindexQueryReinserts = index.Reinserts()
+		space.ReindexQueryPairs = index.Pairs()
+	case *SpaceHash:
+		// Every shape is rehashed each step.
+		space.ReindexQueryReinserts = index.Count()
+		space.ReindexQueryPairs = index.Pairs()
+	case *Sweep1D:
+		space.ReindexQueryReinserts = 0
+		space.ReindexQueryPairs = index.Pairs()
+	}
+
+	space.unlock(false)
+
 	//axc := space.activeShapes.SpatialIndexClass.(*BBTree)
 	//PrintTree(axc.root)
 
-	for h, arb := range space.cachedArbiters {
+	// Rebuild the contact graph (and detect sleeping components if sleeping is enabled)
+	space.ProcessComponents(dt)
+	bodies = space.Bodies
+
+	space.lock()
+
+	for i := 0; i < len(space.cachedArbitersOrder); {
+		arb := space.cachedArbitersOrder[i]
 		ticks := space.stamp - arb.stamp
 		deleted := (arb.BodyA.deleted || arb.BodyB.deleted)
+
+		// Preserve arbiters on sensors and rejected arbiters for sleeping objects.
+		// This prevents errant separate callbacks from happening.
+		if !deleted && (arb.BodyA.IsStatic() || arb.BodyA.IsSleeping()) && (arb.BodyB.IsStatic() || arb.BodyB.IsSleeping()) {
+			i++
+			continue
+		}
+
 		disabled := !(arb.BodyA.Enabled || arb.BodyB.Enabled)
 		if (ticks >= 1 && arb.state != arbiterStateCached) || deleted || disabled {
 			arb.state = arbiterStateCached
@@ -208,15 +300,19 @@ func (space *Space) Step(dt vect.Float) {
 			if arb.BodyB.CallbackHandler != nil {
 				arb.BodyB.CallbackHandler.CollisionExit(arb)
 			}
+			arb.callSeparate(space)
 		}
 		if ticks > time.Duration(space.collisionPersistence) || deleted {
-			delete(space.cachedArbiters, h)
+			// The last arbiter is moved to index i, don't increment it.
+			space.uncacheArbiter(newPair(arb.ShapeA, arb.ShapeB), arb)
 			space.ArbiterBuffer = append(space.ArbiterBuffer, arb)
 			c := arb.Contacts
 			if c != nil {
 				space.ContactBuffer = append(space.ContactBuffer, c)
 			}
+			continue
 		}
+		i++
 	}
 
 	slop := space.collisionSlop
@@ -262,25 +358,25 @@ func (space *Space) Step(dt vect.Float) {
 	//fmt.Println("Arbiters", len(space.Arbiters), biasCoef, dt)
 	//spew.Config.MaxDepth = 3
 	//spew.Config.Indent = "\t"
-	for i := 0; i < space.Iterations; i++ {
-		for _, arb := range space.Arbiters {
-			arb.applyImpulse()
-			//spew.Dump(arb)
-			//spew.Printf("%+v\n", arb)
-		}
+	if space.workers > 1 && len(space.Arbiters)+len(space.Constraints) >= solverMinParallel {
+		space.applyImpulsesParallel()
+	} else {
+		for i := 0; i < space.Iterations; i++ {
+			for _, arb := range space.Arbiters {
+				arb.applyImpulse()
+				//spew.Dump(arb)
+				//spew.Printf("%+v\n", arb)
+			}
 
-		for _, con := range space.Constraints {
-			con.ApplyImpulse()
+			for _, con := range space.Constraints {
+				con.ApplyImpulse()
+			}
 		}
 	}
 
 	//fmt.Println("####")
 	//fmt.Println("")
 
-	//MultiThreadGo()
-	//for i:=0; i<8; i++ {
-	//	<-done
-	//}
 	space.ApplyImpulsesTime = time.Since(start)
 
 	for _, con := range space.Constraints {
@@ -294,6 +390,7 @@ func (space *Space) Step(dt vect.Float) {
 		if arb.ShapeB.Body.CallbackHandler != nil {
 			arb.ShapeB.Body.CallbackHandler.CollisionPostSolve(arb)
 		}
+		arb.callPostSolve(space)
 	}
 
 	if len(space.deleteBodies) > 0 {
@@ -303,37 +400,12 @@ func (space *Space) Step(dt vect.Float) {
 		space.deleteBodies = space.deleteBodies[0:0]
 	}
 
+	space.unlock(true)
+
 	stepEnd := time.Now()
 	space.StepTime = stepEnd.Sub(stepStart)
 }
 
-var done = make(chan bool, 8)
-var start = make(chan bool, 8)
-
-func (space *Space) MultiThreadTest() {
-	for {
-		<-start
-		for i := 0; i < space.Iterations/8; i++ {
-			for _, arb := range space.Arbiters {
-				if arb.ShapeA.IsSensor || arb.ShapeB.IsSensor {
-					continue
-				}
-				arb.applyImpulse()
-			}
-		}
-		done <- true
-	}
-}
-
-func MultiThreadGo() {
-	for i := 0; i < 8; i++ {
-		start <- true
-	}
-	for i := 0; i < 8; i++ {
-		<-done
-	}
-}
-
 func PrintTree(node *Node) {
 	if node != nil {
 		fmt.Println("Parent:")
@@ -350,220 +422,423 @@ func (space *Space) Space() *Space {
 }
 
 func (space *Space) Query(obj Indexable, aabb AABB, fnc SpatialIndexQueryFunc) {
+	space.lock()
+	defer space.unlock(true)
+
 	space.activeShapes.Query(obj, aabb, fnc)
 }
 
 func (space *Space) QueryStatic(obj Indexable, aabb AABB, fnc SpatialIndexQueryFunc) {
+	space.lock()
+	defer space.unlock(true)
+
 	space.staticShapes.Query(obj, aabb, fnc)
 }
 
+// Returns the first shape that contains the point.
 func (space *Space) SpacePointQueryFirst(point vect.Vect, layers Layer, group Group, checkSensors bool) (shape *Shape) {
-
-	found := false
-	pointFunc := func(a, b Indexable) {
-		if found {
+	pointFunc := func(_, b Indexable) {
+		if shape != nil {
 			return
 		}
 		shapeB := b.Shape()
-		shapeA := a.Shape()
-		if !queryRejectShapes(shapeA, shapeB) {
-			if !checkSensors && shapeB.IsSensor {
-				return
-			}
-			contacts := space.pullContactBuffer()
-			numContacts := collide(contacts, shapeA, shapeB)
-			if numContacts <= 0 {
-				space.pushContactBuffer(contacts)
-				return
-			}
+		if !queryFilterShape(shapeB, layers, group, checkSensors) && shapeB.TestPoint(point) {
 			shape = shapeB
-			found = true
 		}
 	}
 
-	dot := NewCircle(vect.Vector_Zero, 0.5)
-	dot.BB = dot.update(transform.NewTransform(point, 0))
-	dot.Layer = layers
-	dot.Group = group
-	space.staticShapes.Query(dot, dot.AABB(), pointFunc)
-	if found {
+	bb := NewAABB(point.X, point.Y, point.X, point.Y)
+	space.staticShapes.Query(nil, bb, pointFunc)
+	if shape != nil {
 		return
 	}
-	space.activeShapes.Query(dot, dot.AABB(), pointFunc)
+	space.activeShapes.Query(nil, bb, pointFunc)
 
 	return
 }
 
+// Returns all the shapes that contain the point.
 func (space *Space) SpacePointQuery(point vect.Vect, layers Layer, group Group, checkSensors bool) (shapes []*Shape) {
+	space.PointQuery(point, layers, group, checkSensors, func(shape *Shape, _ vect.Float, _ vect.Vect) {
+		shapes = append(shapes, shape)
+	})
+	return
+}
 
-	pointFunc := func(a, b Indexable) {
-		shapeB := b.Shape()
-		shapeA := a.Shape()
-		if !queryRejectShapes(shapeA, shapeB) {
-			if !checkSensors && shapeB.IsSensor {
-				return
-			}
-			contacts := space.pullContactBuffer()
-			numContacts := collide(contacts, shapeA, shapeB)
-			if numContacts <= 0 {
-				space.pushContactBuffer(contacts)
-				return
-			}
-			shapes = append(shapes, shapeB)
-		}
+// Switches the spatial indexes of the space to spatial hashes with the given cell size and number of cells.
+// The cell size should be about the size of the shapes and the number of cells about 10 times the number of shapes.
+func (space *Space) UseSpatialHash(cellSize vect.Float, count int) {
+	space.assertUnlocked()
+
+	staticShapes := NewSpaceHash(cellSize, count, nil)
+	activeShapes := NewSpaceHash(cellSize, count, staticShapes)
+	space.useSpatialIndexes(staticShapes, activeShapes)
+}
+
+// Switches the active shapes of the space to a sort and sweep index, the static shapes are kept in a BBTree.
+// Best suited for worlds spread along the x axis such as side scrollers.
+func (space *Space) UseSweep1D() {
+	space.assertUnlocked()
+
+	staticShapes := NewBBTree(nil)
+	activeShapes := NewSweep1D(staticShapes)
+	space.useSpatialIndexes(staticShapes, activeShapes)
+}
+
+// Switches the spatial indexes of the space back to BBTrees, the default.
+func (space *Space) UseBBTree() {
+	space.assertUnlocked()
+
+	staticShapes := NewBBTree(nil)
+	activeShapes := NewBBTree(staticShapes)
+	space.useSpatialIndexes(staticShapes, activeShapes)
+}
+
+func (space *Space) useSpatialIndexes(staticShapes, activeShapes *SpatialIndex) {
+	space.staticShapes.Each(func(node *Node) {
+		staticShapes.Insert(node.obj)
+	})
+	space.activeShapes.Each(func(node *Node) {
+		activeShapes.Insert(node.obj)
+	})
+
+	space.staticShapes = staticShapes
+	space.activeShapes = activeShapes
+}
+
+// Sets how much the bounding boxes of the moving shapes are expanded in the BBTree, margin is a fraction of the size
+// of the shape and velocityCoef a fraction of its velocity. Larger boxes need fewer reinserts but produce more pairs.
+// The defaults are 0.1 and 0.1.
+func (space *Space) SetBBTreeExpansion(margin, velocityCoef vect.Float) {
+	tree := GetTree(space.activeShapes.SpatialIndexClass)
+	if tree == nil {
+		panic("The active shapes are not indexed by a BBTree.")
 	}
+	tree.Margin = margin
+	tree.VelocityCoef = velocityCoef
+}
 
-	dot := NewCircle(vect.Vector_Zero, 0.5)
-	dot.BB = dot.update(transform.NewTransform(point, 0))
-	dot.Layer = layers
-	dot.Group = group
-	space.staticShapes.Query(dot, dot.AABB(), pointFunc)
-	space.activeShapes.Query(dot, dot.AABB(), pointFunc)
+// Rebuilds the tree of the static shapes so it is balanced, call it once after adding the static geometry of a level.
+func (space *Space) OptimizeStatic() {
+	space.assertUnlocked()
 
-	return
+	tree := GetTree(space.staticShapes.SpatialIndexClass)
+	if tree == nil {
+		panic("The static shapes are not indexed by a BBTree.")
+	}
+	tree.Optimize()
+}
+
+// Updates the bounding boxes of all the static shapes, call it after moving static bodies.
+func (space *Space) ReindexStatic() {
+	space.assertUnlocked()
+
+	space.staticShapes.Each(func(node *Node) {
+		node.obj.Shape().Update()
+	})
+	space.staticShapes.Reindex()
+}
+
+// Updates the bounding box of a single shape, call it after moving the body of a static shape.
+func (space *Space) ReindexShape(shape *Shape) {
+	space.assertUnlocked()
+
+	shape.Update()
+
+	// The shape is only in one of the indexes.
+	space.activeShapes.ReindexObject(shape)
+	space.staticShapes.ReindexObject(shape)
+}
+
+// Sets the fraction of velocity bodies retain each second.
+// The default value of 1 means no damping is applied.
+func (space *Space) SetDamping(damping vect.Float) {
+	space.damping = damping
+}
+
+func (space *Space) Damping() vect.Float {
+	return space.damping
+}
+
+// Sets the time a group of bodies must remain idle in order to fall asleep.
+// The default value of Inf disables the sleeping algorithm.
+func (space *Space) SetSleepTimeThreshold(threshold vect.Float) {
+	space.sleepTimeThreshold = threshold
 }
 
-/*
-func (space *Space) SpacePointQuery(point vect.Vect, layers Layer, group Group, cpSpacePointQueryFunc func, void *data)
-{
-	struct PointQueryContext context = {point, layers, group, func, data};
-	cpBB bb = cpBBNewForCircle(point, 0.0f);
+func (space *Space) SleepTimeThreshold() vect.Float {
+	return space.sleepTimeThreshold
+}
+
+// Sets the speed threshold for a body to be considered idle.
+// The default value of 0 means to let the space guess a good threshold based on gravity.
+func (space *Space) SetIdleSpeedThreshold(threshold vect.Float) {
+	space.idleSpeedThreshold = threshold
+}
 
-	cpSpaceLock(space); {
-    cpSpatialIndexQuery(space->activeShapes, &context, bb, (cpSpatialIndexQueryFunc)PointQuery, data);
-    cpSpatialIndexQuery(space->staticShapes, &context, bb, (cpSpatialIndexQueryFunc)PointQuery, data);
-	} cpSpaceUnlock(space, cpTrue);
+func (space *Space) IdleSpeedThreshold() vect.Float {
+	return space.idleSpeedThreshold
 }
-*/
+
+// Moves a sleeping body back into the simulation, restoring its arbiters and constraints.
 func (space *Space) ActiveBody(body *Body) error {
 	if body.IsRogue() {
 		return errors.New("Internal error: Attempting to activate a rouge body.")
 	}
 
+	if space.IsLocked() {
+		// ActiveBody() is called again once the space is unlocked
+		for _, roused := range space.rousedBodies {
+			if roused == body {
+				return nil
+			}
+		}
+		space.rousedBodies = append(space.rousedBodies, body)
+		return nil
+	}
+
 	space.Bodies = append(space.Bodies, body)
 
 	for _, shape := range body.Shapes {
 		space.staticShapes.Remove(shape)
 		space.activeShapes.Insert(shape)
 	}
-	/*
-		for _, arb := range body.Arbiters {
-			bodyA := arb.BodyA
-			if body == bodyA || bodyA.IsStatic() {
 
-					int numContacts = arb->numContacts;
-					cpContact *contacts = arb->contacts;
+	for _, arb := range body.arbiters {
+		bodyA := arb.BodyA
+
+		// Arbiters are shared between two bodies that are always woken up together.
+		// You only want to restore the arbiter once, so bodyA is arbitrarily chosen to own the arbiter.
+		// The edge case is when static bodies are involved as the static bodies never actually sleep.
+		// If the static body is bodyB then all is good. If the static body is bodyA, that can easily be checked.
+		if body == bodyA || bodyA.IsStatic() {
+			// Reinsert the arbiter into the arbiter cache
+			space.cacheArbiter(newPair(arb.ShapeA, arb.ShapeB), arb)
+
+			// Update the arbiter's state
+			arb.stamp = space.stamp
+			space.lookupHandlers(arb)
+			space.Arbiters = append(space.Arbiters, arb)
+		}
+	}
 
-					// Restore contact values back to the space's contact buffer memory
-					arb->contacts = cpContactBufferGetArray(space);
-					memcpy(arb->contacts, contacts, numContacts*sizeof(cpContact));
-					cpSpacePushContacts(space, numContacts);
+	for _, constraint := range body.constraints {
+		bodyA := constraint.Constraint().BodyA
+		if body == bodyA || bodyA.IsStatic() {
+			space.Constraints = append(space.Constraints, constraint)
+		}
+	}
 
-					// Reinsert the arbiter into the arbiter cache
-					arbHashID := hashPair(arb.BodyA.Hash()*20, arb.BodyB.Hash()*10)
-					space.cachedArbiters[arbHashID] = arb
+	return nil
+}
 
-					// Update the arbiter's state
-					arb.stamp = space.stamp
-					space->arbiters = append(space->arbiters, arb)
+// Removes a body from the simulation, its shapes are moved to the static index
+// and its arbiters and constraints are kept on the body until it is activated.
+func (space *Space) deactivateBody(body *Body) {
+	for i, pbody := range space.Bodies {
+		if pbody == body {
+			last := len(space.Bodies) - 1
+			space.Bodies[i], space.Bodies = space.Bodies[last], space.Bodies[:last]
+			break
+		}
+	}
 
-					//cpfree(contacts);
+	for _, shape := range body.Shapes {
+		space.activeShapes.Remove(shape)
+		space.staticShapes.Insert(shape)
+	}
 
-			}
+	for _, arb := range body.arbiters {
+		bodyA := arb.BodyA
+		if body == bodyA || bodyA.IsStatic() {
+			space.uncacheArbiter(newPair(arb.ShapeA, arb.ShapeB), arb)
 		}
-	*/
+	}
 
-	return nil
+	for _, constraint := range body.constraints {
+		bodyA := constraint.Constraint().BodyA
+		if body == bodyA || bodyA.IsStatic() {
+			for i, c := range space.Constraints {
+				if c == constraint {
+					last := len(space.Constraints) - 1
+					space.Constraints[i], space.Constraints = space.Constraints[last], space.Constraints[:last]
+					break
+				}
+			}
+		}
+	}
 }
 
+// Builds the contact graph from the current arbiters and constraints,
+// wakes up bodies touched by active ones and puts idle components to sleep.
 func (space *Space) ProcessComponents(dt vect.Float) {
 
-	sleep := math.IsInf(float64(space.sleepTimeThreshold), 0)
-	bodies := space.Bodies
-	_ = bodies
+	sleep := !math.IsInf(float64(space.sleepTimeThreshold), 0)
+
+	// Calculate the kinetic energy of all the bodies.
 	if sleep {
 		dv := space.idleSpeedThreshold
-		dvsq := vect.Float(0)
-		if dv == 0 {
+		dvsq := space.Gravity.LengthSqr() * dt * dt
+		if dv != 0 {
 			dvsq = dv * dv
-		} else {
-			dvsq = space.Gravity.LengthSqr() * dt * dt
 		}
 
+		// update idling
 		for _, body := range space.Bodies {
+			// Kinematic bodies never fall asleep, leave their idle time at 0.
+			if body.kinematic {
+				continue
+			}
+
+			// Need to deal with infinite mass objects
 			keThreshold := vect.Float(0)
 			if dvsq != 0 {
 				keThreshold = body.m * dvsq
 			}
-			body.node.IdleTime = 0
-			if body.KineticEnergy() <= keThreshold {
+			if body.KineticEnergy() > keThreshold {
+				body.node.IdleTime = 0
+			} else {
 				body.node.IdleTime += dt
 			}
 		}
 	}
 
-	for _, arb := range space.Arbiters {
+	// Awaken any sleeping bodies found and then push arbiters to the bodies' lists.
+	arbiters := space.Arbiters
+	for _, arb := range arbiters {
 		a, b := arb.BodyA, arb.BodyB
-		_, _ = a, b
-		if sleep {
 
+		if sleep {
+			if (b.IsRogue() && !b.IsStatic()) || b.kinematic || a.IsSleeping() {
+				a.Activate()
+			}
+			if (a.IsRogue() && !a.IsStatic()) || a.kinematic || b.IsSleeping() {
+				b.Activate()
+			}
 		}
+
+		a.pushArbiter(arb)
+		b.pushArbiter(arb)
 	}
-	/*
-		// Awaken any sleeping bodies found and then push arbiters to the bodies' lists.
-		cpArray *arbiters = space->arbiters;
-		for(int i=0, count=arbiters->num; i<count; i++){
-			cpArbiter *arb = (cpArbiter*)arbiters->arr[i];
-			cpBody *a = arb->body_a, *b = arb->body_b;
 
-			if(sleep){
-				if((cpBodyIsRogue(b) && !cpBodyIsStatic(b)) || cpBodyIsSleeping(a)) cpBodyActivate(a);
-				if((cpBodyIsRogue(a) && !cpBodyIsStatic(a)) || cpBodyIsSleeping(b)) cpBodyActivate(b);
-			}
+	if sleep {
+		// Bodies should be held active if connected by a joint to a non-static rouge or a kinematic body.
+		for _, constraint := range space.Constraints {
+			con := constraint.Constraint()
+			a, b := con.BodyA, con.BodyB
 
-			cpBodyPushArbiter(a, arb);
-			cpBodyPushArbiter(b, arb);
+			if (b.IsRogue() && !b.IsStatic()) || b.kinematic {
+				a.Activate()
+			}
+			if (a.IsRogue() && !a.IsStatic()) || a.kinematic {
+				b.Activate()
+			}
 		}
 
-		if(sleep){
-			// Bodies should be held active if connected by a joint to a non-static rouge body.
-			cpArray *constraints = space->constraints;
-			for(int i=0; i<constraints->num; i++){
-				cpConstraint *constraint = (cpConstraint *)constraints->arr[i];
-				cpBody *a = constraint->a, *b = constraint->b;
+		// Generate components and deactivate sleeping ones
+		for i := 0; i < len(space.Bodies); {
+			body := space.Bodies[i]
+
+			if body.ComponentRoot() == nil {
+				// Body not in a component yet. Perform a DFS to flood fill mark
+				// the component in the contact graph using this body as the root.
+				body.floodFillComponent(body)
 
-				if(cpBodyIsRogue(b) && !cpBodyIsStatic(b)) cpBodyActivate(a);
-				if(cpBodyIsRogue(a) && !cpBodyIsStatic(a)) cpBodyActivate(b);
+				// Check if the component should be put to sleep.
+				if !body.ComponentActive(space.sleepTimeThreshold) {
+					space.sleepingComponents = append(space.sleepingComponents, body)
+					for other := body; other != nil; other = other.node.Next {
+						space.deactivateBody(other)
+					}
+
+					// deactivateBody() removed the current body from the list.
+					// Skip incrementing the index counter.
+					continue
+				}
 			}
 
-			// Generate components and deactivate sleeping ones
-			for(int i=0; i<bodies->num;){
-				cpBody *body = (cpBody*)bodies->arr[i];
+			i++
+
+			// Only sleeping bodies retain their component node pointers.
+			body.node.Root = nil
+			body.node.Next = nil
+		}
+	}
+}
 
-				if(ComponentRoot(body) == NULL){
-					// Body not in a component yet. Perform a DFS to flood fill mark
-					// the component in the contact graph using this body as the root.
-					FloodFillComponent(body, body);
+func (space *Space) cacheArbiter(h HashPair, arb *Arbiter) {
+	if _, ok := space.cachedArbiters[h]; ok {
+		return
+	}
 
-					// Check if the component should be put to sleep.
-					if(!ComponentActive(body, space->sleepTimeThreshold)){
-						cpArrayPush(space->sleepingComponents, body);
-						CP_BODY_FOREACH_COMPONENT(body, other) cpSpaceDeactivateBody(space, other);
+	space.cachedArbiters[h] = arb
+	arb.cacheIndex = len(space.cachedArbitersOrder)
+	space.cachedArbitersOrder = append(space.cachedArbitersOrder, arb)
+}
 
-						// cpSpaceDeactivateBody() removed the current body from the list.
-						// Skip incrementing the index counter.
-						continue;
-					}
-				}
+func (space *Space) uncacheArbiter(h HashPair, arb *Arbiter) {
+	if space.cachedArbiters[h] != arb {
+		return
+	}
 
-				i++;
+	delete(space.cachedArbiters, h)
+	last := len(space.cachedArbitersOrder) - 1
+	moved := space.cachedArbitersOrder[last]
+	space.cachedArbitersOrder[arb.cacheIndex], moved.cacheIndex = moved, arb.cacheIndex
+	space.cachedArbitersOrder[last] = nil
+	space.cachedArbitersOrder = space.cachedArbitersOrder[:last]
 
-				// Only sleeping bodies retain their component node pointers.
-				body->node.root = NULL;
-				body->node.next = NULL;
+	// An uncached arbiter is not solved, remove it from the arbiters of the current step too.
+	// Only the arbiters stamped in the current step can be in the list.
+	if arb.stamp != space.stamp {
+		return
+	}
+	for i, a := range space.Arbiters {
+		if a == arb {
+			space.Arbiters = append(space.Arbiters[:i], space.Arbiters[i+1:]...)
+			break
+		}
+	}
+}
+
+// Removes the arbiters touching the body, calling the separate callbacks of the ones still touching,
+// and wakes up the bodies they touch.
+// Based on cpSpaceFilterArbiters.
+func (space *Space) filterArbiters(body *Body) {
+	// Wake up the bodies first, activating a body caches its arbiters again.
+	for _, arb := range space.cachedArbitersOrder {
+		if arb.BodyA == body {
+			arb.BodyB.Activate()
+		} else if arb.BodyB == body {
+			arb.BodyA.Activate()
+		}
+	}
+
+	for i := 0; i < len(space.cachedArbitersOrder); {
+		arb := space.cachedArbitersOrder[i]
+		if arb.BodyA != body && arb.BodyB != body {
+			i++
+			continue
+		}
+
+		if arb.state != arbiterStateCached {
+			arb.state = arbiterStateCached
+			if arb.BodyA.CallbackHandler != nil {
+				arb.BodyA.CallbackHandler.CollisionExit(arb)
+			}
+			if arb.BodyB.CallbackHandler != nil {
+				arb.BodyB.CallbackHandler.CollisionExit(arb)
 			}
+			arb.callSeparate(space)
+		}
+
+		// The last arbiter is moved to index i, don't increment it.
+		space.uncacheArbiter(newPair(arb.ShapeA, arb.ShapeB), arb)
+		space.ArbiterBuffer = append(space.ArbiterBuffer, arb)
+		if arb.Contacts != nil {
+			space.ContactBuffer = append(space.ContactBuffer, arb.Contacts)
 		}
-	*/
+	}
 }
 
 // Creates an arbiter between the given shapes.
@@ -601,6 +876,11 @@ func (space *Space) CreateArbiter(sa, sb *Shape) *Arbiter {
 	arb.NumContacts = 0
 	arb.e = 0
 	arb.u = 0
+	arb.handler = nil
+	arb.handlerA = nil
+	arb.handlerB = nil
+	arb.handlerSwapped = false
+	arb.swapped = false
 
 	return arb
 }
@@ -618,9 +898,6 @@ func SpaceCollideShapes(a, b *Shape, space *Space) {
 		a, b = b, a
 	}
 
-	//cpCollisionHandler *handler = cpSpaceLookupHandler(space, a->collision_type, b->collision_type);
-
-	sensor := a.IsSensor || b.IsSensor
 	//if(sensor && handler == &cpDefaultCollisionHandler) return;
 	//if sensor {
 	//	return
@@ -635,7 +912,12 @@ func SpaceCollideShapes(a, b *Shape, space *Space) {
 		return // Shapes are not colliding.
 	}
 
-	contacts = contacts[:numContacts]
+	space.collideShapesContacts(a, b, contacts[:numContacts], numContacts)
+}
+
+// Updates the arbiter of two colliding shapes with their new contacts and calls the callbacks.
+func (space *Space) collideShapesContacts(a, b *Shape, contacts []*Contact, numContacts int) {
+	sensor := a.IsSensor || b.IsSensor
 
 	// Get an arbiter from space->arbiterSet for the two shapes.
 	// This is where the persistant contact magic comes from.
@@ -658,8 +940,11 @@ func SpaceCollideShapes(a, b *Shape, space *Space) {
 	if oldContacts != nil {
 		space.pushContactBuffer(oldContacts)
 	}
+	space.lookupHandlers(arb)
 
-	space.cachedArbiters[arbHashID] = arb
+	if !exist {
+		space.cacheArbiter(arbHashID, arb)
+	}
 
 	// Call the begin function first if it's the first step
 	if arb.state == arbiterStateFirstColl {
@@ -670,6 +955,9 @@ func SpaceCollideShapes(a, b *Shape, space *Space) {
 		if a.Body.CallbackHandler != nil {
 			ignore = ignore || !a.Body.CallbackHandler.CollisionEnter(arb)
 		}
+		if !arb.callBegin(space) {
+			ignore = true
+		}
 		if ignore {
 			arb.Ignore() // permanently ignore the collision until separation
 		}
@@ -686,11 +974,14 @@ func SpaceCollideShapes(a, b *Shape, space *Space) {
 		if arb.ShapeB.Body.CallbackHandler != nil {
 			preSolveResult = preSolveResult || arb.ShapeB.Body.CallbackHandler.CollisionPreSolve(arb)
 		}
+		if !arb.callPreSolve(space) {
+			preSolveResult = false
+		}
 	}
 
 	if preSolveResult &&
-		// Process, but don't add collisions for sensors.
-		!sensor {
+		// Process, but don't add collisions for sensors or ignored arbiters.
+		!sensor && arb.state != arbiterStateIgnore {
 		space.Arbiters = append(space.Arbiters, arb)
 	} else {
 		//cpSpacePopContacts(space, numContacts);
@@ -721,6 +1012,13 @@ func queryReject(a, b *Shape) bool {
 }
 
 func (space *Space) AddBody(body *Body) *Body {
+	if space.IsLocked() {
+		space.AddPostStepCallback(postStepOp{body, false}, func(space *Space, _ interface{}) {
+			space.AddBody(body)
+		})
+		return body
+	}
+
 	if body.space != nil {
 		println("This body is already added to a space and cannot be added to another.")
 		return body
@@ -741,12 +1039,20 @@ func (space *Space) AddBody(body *Body) *Body {
 }
 
 func (space *Space) AddShape(shape *Shape) *Shape {
+	if space.IsLocked() {
+		space.AddPostStepCallback(postStepOp{shape, false}, func(space *Space, _ interface{}) {
+			space.AddShape(shape)
+		})
+		return shape
+	}
+
 	if shape.space != nil {
 		println("This shape is already added to a space and cannot be added to another.")
 		return shape
 	}
 
 	shape.space = space
+	shape.Body.Activate()
 	shape.Update()
 	if shape.Body.IsStatic() {
 		space.staticShapes.Insert(shape)
@@ -758,32 +1064,45 @@ func (space *Space) AddShape(shape *Shape) *Shape {
 }
 
 func (space *Space) AddConstraint(constraint Constraint) Constraint {
+	if space.IsLocked() {
+		space.AddPostStepCallback(postStepOp{constraint, false}, func(space *Space, _ interface{}) {
+			space.AddConstraint(constraint)
+		})
+		return constraint
+	}
+
 	con := constraint.Constraint()
 	if con.space != nil {
 		panic("This shape is already added to a space and cannot be added to another.")
 	}
 
-	con.BodyA.BodyActivate()
-	con.BodyB.BodyActivate()
+	con.BodyA.Activate()
+	con.BodyB.Activate()
 	space.Constraints = append(space.Constraints, constraint)
 
-	// Push onto the heads of the bodies' constraint lists
-	//cpBody *a = constraint->a, *b = constraint->b;
-	//constraint->next_a = a->constraintList; a->constraintList = constraint;
-	//constraint->next_b = b->constraintList; b->constraintList = constraint;
+	// Push onto the bodies' constraint lists
+	con.BodyA.constraints = append(con.BodyA.constraints, constraint)
+	con.BodyB.constraints = append(con.BodyB.constraints, constraint)
 	con.space = space
 
 	return constraint
 }
 
 func (space *Space) RemoveConstraint(constraint Constraint) {
+	if space.IsLocked() {
+		space.AddPostStepCallback(postStepOp{constraint, true}, func(space *Space, _ interface{}) {
+			space.RemoveConstraint(constraint)
+		})
+		return
+	}
+
 	con := constraint.Constraint()
 	if con.space == nil {
 		panic("Cannot remove a constraint that was not added to the space. (Removed twice maybe?)")
 	}
 
-	con.BodyA.BodyActivate()
-	con.BodyB.BodyActivate()
+	con.BodyA.Activate()
+	con.BodyB.Activate()
 
 	for i, c := range space.Constraints {
 		if constraint == c {
@@ -792,8 +1111,8 @@ func (space *Space) RemoveConstraint(constraint Constraint) {
 		}
 	}
 
-	//cpBodyRemoveConstraint(constraint->a, constraint);
-	//cpBodyRemoveConstraint(constraint->b, constraint);
+	con.BodyA.removeConstraint(constraint)
+	con.BodyB.removeConstraint(constraint)
 	con.space = nil
 	con.BodyA = nil
 	con.BodyB = nil
@@ -801,7 +1120,9 @@ func (space *Space) RemoveConstraint(constraint Constraint) {
 
 func (space *Space) removeBody(body *Body) {
 	for _, shape := range body.Shapes {
-		space.RemoveShape(shape)
+		if shape.space != nil {
+			space.removeShape(shape)
+		}
 	}
 	body.space = nil
 	body.Shapes = nil
@@ -815,7 +1136,21 @@ func (space *Space) RemoveBody(body *Body) {
 	if body == nil {
 		return
 	}
-	body.BodyActivate()
+	if space.IsLocked() {
+		space.AddPostStepCallback(postStepOp{body, true}, func(space *Space, _ interface{}) {
+			// Remove the shapes right away, the deleted bodies are only removed at the end of the next step.
+			space.detachBody(body)
+			space.removeBody(body)
+		})
+		return
+	}
+	space.detachBody(body)
+	space.deleteBodies = append(space.deleteBodies, body)
+}
+
+// Removes the body from the simulated bodies and marks it as deleted, so its arbiters are removed.
+func (space *Space) detachBody(body *Body) {
+	body.Activate()
 	for i, pbody := range space.Bodies {
 		if pbody == body {
 			space.Bodies[i], space.Bodies = space.Bodies[len(space.Bodies)-1], space.Bodies[:len(space.Bodies)-1]
@@ -823,14 +1158,26 @@ func (space *Space) RemoveBody(body *Body) {
 		}
 	}
 	body.deleted = true
-	space.deleteBodies = append(space.deleteBodies, body)
 }
 
 func (space *Space) RemoveShape(shape *Shape) {
+	if space.IsLocked() {
+		space.AddPostStepCallback(postStepOp{shape, true}, func(space *Space, _ interface{}) {
+			space.RemoveShape(shape)
+		})
+		return
+	}
+
+	shape.Body.removeShape(shape)
+	space.removeShape(shape)
+}
+
+func (space *Space) removeShape(shape *Shape) {
 	shape.space = nil
 	if shape.Body.IsStatic() {
 		space.staticShapes.Remove(shape)
 	} else {
+		shape.Body.Activate()
 		space.activeShapes.Remove(shape)
 	}
 	shape.Body = nil
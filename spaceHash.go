@@ -0,0 +1,422 @@
+package chipmunk
+
+import (
+	"math"
+	"time"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Spatial hash based on cpSpaceHash, a uniform grid hashed into a fixed size table.
+// Works best when the objects are about the same size, the cell size should be about the size of the objects.
+// The objects are kept in leaf nodes so they can be iterated like the leaves of a BBTree.
+type SpaceHash struct {
+	SpatialIndexClass
+	SpatialIndex *SpatialIndex
+
+	numCells int
+	cellDim  vect.Float
+
+	table   []*spaceHashBin
+	handles HashSet
+	// The handles in the order they were inserted, iterated instead of the handles map to keep stepping deterministic.
+	handleOrder []*Node
+
+	pooledBins *spaceHashBin
+
+	stamp time.Duration
+
+	// Number of pairs found by the last ReindexQuery.
+	pairs int
+}
+
+// Linked list of the handles in a cell of the table.
+type spaceHashBin struct {
+	handle *Node
+	next   *spaceHashBin
+}
+
+var spaceHashPrimes = []int{
+	5,
+	13,
+	23,
+	47,
+	97,
+	193,
+	389,
+	769,
+	1543,
+	3079,
+	6151,
+	12289,
+	24593,
+	49157,
+	98317,
+	196613,
+	393241,
+	786433,
+	1572869,
+	3145739,
+	6291469,
+	12582917,
+	25165843,
+	50331653,
+	100663319,
+	201326611,
+	402653189,
+	805306457,
+	1610612741,
+}
+
+func nextPrime(n int) int {
+	for _, prime := range spaceHashPrimes {
+		if n <= prime {
+			return prime
+		}
+	}
+	panic("Tried to resize a hash table to a size greater than 1610612741 O_o")
+}
+
+func NewSpaceHash(cellDim vect.Float, numCells int, staticIndex *SpatialIndex) *SpatialIndex {
+	hash := &SpaceHash{}
+	hash.handles = make(HashSet)
+	hash.stamp = 1
+	hash.cellDim = cellDim
+	hash.allocTable(nextPrime(numCells))
+
+	hash.SpatialIndex = NewSpartialIndex(hash, staticIndex)
+	return hash.SpatialIndex
+}
+
+func (hash *SpaceHash) allocTable(numCells int) {
+	hash.numCells = numCells
+	hash.table = make([]*spaceHashBin, numCells)
+}
+
+func (hash *SpaceHash) Destroy() {
+	hash.clearTable()
+	hash.handles = nil
+	hash.handleOrder = nil
+	hash.table = nil
+	hash.pooledBins = nil
+}
+
+// Changes the cell size and the number of cells of the table and rehashes all the objects.
+func (hash *SpaceHash) Resize(cellDim vect.Float, numCells int) {
+	hash.clearTable()
+
+	hash.cellDim = cellDim
+	hash.allocTable(nextPrime(numCells))
+
+	hash.Reindex()
+}
+
+func (hash *SpaceHash) Count() int {
+	return len(hash.handles)
+}
+
+func (hash *SpaceHash) Each(fnc HashSetIterator) {
+	for _, hand := range hash.handleOrder {
+		fnc(hand)
+	}
+}
+
+func (hash *SpaceHash) Contains(obj Indexable) bool {
+	return hash.handles[obj.Hash()] != nil
+}
+
+func (hash *SpaceHash) Stamp() time.Duration {
+	return hash.stamp
+}
+
+// Returns the number of pairs of overlapping objects found by the last ReindexQuery.
+func (hash *SpaceHash) Pairs() int {
+	return hash.pairs
+}
+
+func (hash *SpaceHash) Insert(obj Indexable) {
+	hand := &Node{obj: obj}
+	hash.handles[obj.Hash()] = hand
+	hand.index = len(hash.handleOrder)
+	hash.handleOrder = append(hash.handleOrder, hand)
+
+	hash.hashHandle(hand, obj.AABB())
+}
+
+func (hash *SpaceHash) Remove(obj Indexable) {
+	hand := hash.handles[obj.Hash()]
+	if hand == nil {
+		return
+	}
+	delete(hash.handles, obj.Hash())
+
+	last := len(hash.handleOrder) - 1
+	moved := hash.handleOrder[last]
+	hash.handleOrder[hand.index], moved.index = moved, hand.index
+	hash.handleOrder[last] = nil
+	hash.handleOrder = hash.handleOrder[:last]
+
+	// The bins still pointing to the handle are removed lazily by the queries.
+	hand.obj = nil
+}
+
+func (hash *SpaceHash) Reindex() {
+	hash.clearTable()
+	for _, hand := range hash.handleOrder {
+		hash.hashHandle(hand, hand.obj.AABB())
+	}
+}
+
+func (hash *SpaceHash) ReindexObject(obj Indexable) {
+	if hash.handles[obj.Hash()] != nil {
+		hash.Remove(obj)
+		hash.Insert(obj)
+	}
+}
+
+func (hash *SpaceHash) ReindexQuery(fnc SpatialIndexQueryFunc) {
+	hash.pairs = 0
+	countFnc := fnc
+	fnc = func(a, b Indexable) {
+		hash.pairs++
+		countFnc(a, b)
+	}
+
+	hash.clearTable()
+
+	for _, hand := range hash.handleOrder {
+		hash.queryRehash(hand, fnc)
+	}
+
+	if staticIndex := hash.SpatialIndex.staticIndex; staticIndex != nil {
+		SpatialIndexCollideStatic(hash, staticIndex, fnc)
+	}
+}
+
+func (hash *SpaceHash) Query(obj Indexable, aabb AABB, fnc SpatialIndexQueryFunc) {
+	l, b, r, t := hash.cellRange(aabb)
+
+	for i := l; i <= r; i++ {
+		for j := b; j <= t; j++ {
+			hash.queryBin(&hash.table[hash.index(i, j)], obj, fnc)
+		}
+	}
+
+	hash.stamp++
+}
+
+// Walks the cells touched by the segment from a to b.
+func (hash *SpaceHash) SegmentQuery(obj Indexable, a, b vect.Vect, t_exit vect.Float, fnc SpatialIndexSegmentQueryFunc) {
+	a = vect.Mult(a, 1/hash.cellDim)
+	b = vect.Mult(b, 1/hash.cellDim)
+
+	cellX, cellY := floorInt(a.X), floorInt(a.Y)
+
+	t := vect.Float(0)
+
+	var xInc, yInc int
+	var tempV, tempH vect.Float
+
+	if b.X > a.X {
+		xInc = 1
+		tempH = vect.Float(math.Floor(float64(a.X+1))) - a.X
+	} else {
+		xInc = -1
+		tempH = a.X - vect.Float(math.Floor(float64(a.X)))
+	}
+
+	if b.Y > a.Y {
+		yInc = 1
+		tempV = vect.Float(math.Floor(float64(a.Y+1))) - a.Y
+	} else {
+		yInc = -1
+		tempV = a.Y - vect.Float(math.Floor(float64(a.Y)))
+	}
+
+	// The segment never crosses a cell boundary along an axis it is parallel to.
+	// Checking the deltas instead of the distances to the boundaries avoids 0*Inf NaNs
+	// while still crossing immediately when starting on a boundary.
+	dx, dy := vect.FAbs(b.X-a.X), vect.FAbs(b.Y-a.Y)
+	dtdx, dtdy := Inf, Inf
+	nextH, nextV := Inf, Inf
+	if dx != 0 {
+		dtdx = 1 / dx
+		nextH = tempH * dtdx
+	}
+	if dy != 0 {
+		dtdy = 1 / dy
+		nextV = tempV * dtdy
+	}
+
+	for t < t_exit {
+		t_exit = vect.FMin(t_exit, hash.segmentQueryBin(&hash.table[hash.index(cellX, cellY)], obj, fnc))
+
+		if nextV < nextH {
+			cellY += yInc
+			t = nextV
+			nextV += dtdy
+		} else {
+			cellX += xInc
+			t = nextH
+			nextH += dtdx
+		}
+	}
+
+	hash.stamp++
+}
+
+func floorInt(f vect.Float) int {
+	return int(math.Floor(float64(f)))
+}
+
+// Returns the cells covered by the bounding box.
+func (hash *SpaceHash) cellRange(aabb AABB) (l, b, r, t int) {
+	dim := hash.cellDim
+	return floorInt(aabb.Lower.X / dim), floorInt(aabb.Lower.Y / dim), floorInt(aabb.Upper.X / dim), floorInt(aabb.Upper.Y / dim)
+}
+
+func (hash *SpaceHash) index(x, y int) int {
+	return int((uint64(x)*1640531513 ^ uint64(y)*2654435789) % uint64(hash.numCells))
+}
+
+func (hash *SpaceHash) binFromPool() *spaceHashBin {
+	bin := hash.pooledBins
+	if bin != nil {
+		hash.pooledBins = bin.next
+		return bin
+	}
+	return &spaceHashBin{}
+}
+
+func (hash *SpaceHash) binRecycle(bin *spaceHashBin) {
+	bin.handle = nil
+	bin.next = hash.pooledBins
+	hash.pooledBins = bin
+}
+
+func (hash *SpaceHash) clearTable() {
+	for i, bin := range hash.table {
+		for bin != nil {
+			next := bin.next
+			hash.binRecycle(bin)
+			bin = next
+		}
+		hash.table[i] = nil
+	}
+}
+
+func containsHandle(bin *spaceHashBin, hand *Node) bool {
+	for ; bin != nil; bin = bin.next {
+		if bin.handle == hand {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds the handle to all the cells covered by the bounding box.
+func (hash *SpaceHash) hashHandle(hand *Node, aabb AABB) {
+	l, b, r, t := hash.cellRange(aabb)
+
+	for i := l; i <= r; i++ {
+		for j := b; j <= t; j++ {
+			idx := hash.index(i, j)
+			bin := hash.table[idx]
+
+			// Don't add an object twice to the same cell.
+			if containsHandle(bin, hand) {
+				continue
+			}
+
+			newBin := hash.binFromPool()
+			newBin.handle = hand
+			newBin.next = bin
+			hash.table[idx] = newBin
+		}
+	}
+}
+
+// Adds the handle back to the cells covered by its object, reporting the objects already in them.
+func (hash *SpaceHash) queryRehash(hand *Node, fnc SpatialIndexQueryFunc) {
+	obj := hand.obj
+	l, b, r, t := hash.cellRange(obj.AABB())
+
+	for i := l; i <= r; i++ {
+		for j := b; j <= t; j++ {
+			idx := hash.index(i, j)
+			bin := hash.table[idx]
+
+			if containsHandle(bin, hand) {
+				continue
+			}
+
+			hash.queryBin(&bin, obj, fnc)
+
+			newBin := hash.binFromPool()
+			newBin.handle = hand
+			newBin.next = bin
+			hash.table[idx] = newBin
+		}
+	}
+
+	// Increment the stamp for each object hashed.
+	hash.stamp++
+}
+
+// Removes the bins of the removed objects from the cell.
+func (hash *SpaceHash) removeOrphanedHandles(binPtr **spaceHashBin) {
+	for bin := *binPtr; bin != nil; bin = *binPtr {
+		if bin.handle.obj == nil {
+			*binPtr = bin.next
+			hash.binRecycle(bin)
+		} else {
+			binPtr = &bin.next
+		}
+	}
+}
+
+// Calls fnc for every object of the cell not already reported during this query.
+func (hash *SpaceHash) queryBin(binPtr **spaceHashBin, obj Indexable, fnc SpatialIndexQueryFunc) {
+restart:
+	for bin := *binPtr; bin != nil; bin = bin.next {
+		hand := bin.handle
+		other := hand.obj
+
+		if hand.stamp == hash.stamp || obj == other {
+			continue
+		} else if other != nil {
+			fnc(obj, other)
+			hand.stamp = hash.stamp
+		} else {
+			// The object for this handle has been removed
+			// cleanup this cell and restart the query
+			hash.removeOrphanedHandles(binPtr)
+			goto restart
+		}
+	}
+}
+
+func (hash *SpaceHash) segmentQueryBin(binPtr **spaceHashBin, obj Indexable, fnc SpatialIndexSegmentQueryFunc) vect.Float {
+	t := vect.Float(1)
+
+restart:
+	for bin := *binPtr; bin != nil; bin = bin.next {
+		hand := bin.handle
+		other := hand.obj
+
+		// Skip over certain conditions
+		if hand.stamp == hash.stamp {
+			continue
+		} else if other != nil {
+			t = vect.FMin(t, fnc(obj, other))
+			hand.stamp = hash.stamp
+		} else {
+			// The object for this handle has been removed
+			// cleanup this cell and restart the query
+			hash.removeOrphanedHandles(binPtr)
+			goto restart
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,193 @@
+package chipmunk
+
+import (
+	"github.com/vova616/chipmunk/transform"
+	"github.com/vova616/chipmunk/vect"
+)
+
+type SpaceSegmentQueryFunc func(shape *Shape, t vect.Float, n vect.Vect)
+
+type SpaceBBQueryFunc func(shape *Shape)
+
+// Called with the contacts between the query shape and shape, normals point towards shape.
+type SpaceShapeQueryFunc func(shape *Shape, points *ContactPointSet)
+
+// Called with the distance to the surface (negative inside the shape) and the closest point on it.
+type SpacePointQueryFunc func(shape *Shape, distance vect.Float, point vect.Vect)
+
+// Returns true if the shape should be skipped by a query with the given layers and group.
+func queryFilterShape(shape *Shape, layers Layer, group Group, checkSensors bool) bool {
+	return (shape.Group != 0 && shape.Group == group) || (shape.Layer&layers) == 0 || (!checkSensors && shape.IsSensor) || (shape.Body != nil && !shape.Body.Enabled)
+}
+
+// Calls fnc for every shape that contains the point.
+func (space *Space) PointQuery(point vect.Vect, layers Layer, group Group, checkSensors bool, fnc SpacePointQueryFunc) {
+	space.lock()
+	defer space.unlock(true)
+
+	pointFunc := func(_, b Indexable) {
+		shape := b.Shape()
+		if queryFilterShape(shape, layers, group, checkSensors) || !shape.TestPoint(point) {
+			return
+		}
+
+		info := shape.NearestPointQuery(point)
+		fnc(shape, info.Distance, info.Point)
+	}
+
+	bb := NewAABB(point.X, point.Y, point.X, point.Y)
+	space.staticShapes.Query(nil, bb, pointFunc)
+	space.activeShapes.Query(nil, bb, pointFunc)
+}
+
+// Calls fnc for every shape within maxDistance of the point.
+func (space *Space) NearestPointQuery(point vect.Vect, maxDistance vect.Float, layers Layer, group Group, checkSensors bool, fnc SpacePointQueryFunc) {
+	space.lock()
+	defer space.unlock(true)
+
+	nearestFunc := func(_, b Indexable) {
+		shape := b.Shape()
+		if queryFilterShape(shape, layers, group, checkSensors) {
+			return
+		}
+
+		info := shape.NearestPointQuery(point)
+		if info.Distance < maxDistance {
+			fnc(shape, info.Distance, info.Point)
+		}
+	}
+
+	bb := NewAABBForCircle(point, vect.FMax(maxDistance, 0))
+	space.staticShapes.Query(nil, bb, nearestFunc)
+	space.activeShapes.Query(nil, bb, nearestFunc)
+}
+
+// Returns the shape closest to the point within maxDistance.
+// info.Shape is nil if no shape was found.
+func (space *Space) NearestPointQueryNearest(point vect.Vect, maxDistance vect.Float, layers Layer, group Group, checkSensors bool) (info NearestPointQueryInfo) {
+	info.Distance = maxDistance
+
+	nearestFunc := func(_, b Indexable) {
+		shape := b.Shape()
+		if queryFilterShape(shape, layers, group, checkSensors) {
+			return
+		}
+
+		nearest := shape.NearestPointQuery(point)
+		if nearest.Distance < info.Distance {
+			info = nearest
+		}
+	}
+
+	bb := NewAABBForCircle(point, vect.FMax(maxDistance, 0))
+	space.staticShapes.Query(nil, bb, nearestFunc)
+	space.activeShapes.Query(nil, bb, nearestFunc)
+
+	return
+}
+
+// Calls fnc for every shape touched by the segment from start to end.
+func (space *Space) SegmentQuery(start, end vect.Vect, layers Layer, group Group, checkSensors bool, fnc SpaceSegmentQueryFunc) {
+	space.lock()
+	defer space.unlock(true)
+
+	segQuery := func(_, b Indexable) vect.Float {
+		shape := b.Shape()
+		if queryFilterShape(shape, layers, group, checkSensors) {
+			return 1
+		}
+
+		info := SegmentQueryInfo{}
+		if shape.SegmentQuery(start, end, &info) {
+			fnc(shape, info.T, info.Normal)
+		}
+		return 1
+	}
+
+	space.staticShapes.SegmentQuery(nil, start, end, 1, segQuery)
+	space.activeShapes.SegmentQuery(nil, start, end, 1, segQuery)
+}
+
+// Returns the first shape hit by the segment from start to end.
+// info.Shape is nil if nothing was hit.
+func (space *Space) SegmentQueryFirst(start, end vect.Vect, layers Layer, group Group, checkSensors bool) (info SegmentQueryInfo) {
+	info.T = 1
+
+	segQuery := func(_, b Indexable) vect.Float {
+		shape := b.Shape()
+		if queryFilterShape(shape, layers, group, checkSensors) {
+			return 1
+		}
+
+		hit := SegmentQueryInfo{}
+		if shape.SegmentQuery(start, end, &hit) && hit.T < info.T {
+			info = hit
+		}
+		return info.T
+	}
+
+	space.staticShapes.SegmentQuery(nil, start, end, 1, segQuery)
+	space.activeShapes.SegmentQuery(nil, start, end, info.T, segQuery)
+
+	return
+}
+
+// Calls fnc for every shape whose bounding box overlaps aabb.
+func (space *Space) BBQuery(aabb AABB, layers Layer, group Group, checkSensors bool, fnc SpaceBBQueryFunc) {
+	space.lock()
+	defer space.unlock(true)
+
+	bbQuery := func(_, b Indexable) {
+		shape := b.Shape()
+		if !queryFilterShape(shape, layers, group, checkSensors) && TestOverlapPtr(&aabb, &shape.BB) {
+			fnc(shape)
+		}
+	}
+
+	space.staticShapes.Query(nil, aabb, bbQuery)
+	space.activeShapes.Query(nil, aabb, bbQuery)
+}
+
+// Calls fnc for every shape that collides with the given shape.
+// The shape does not need to be added to the space, if it has no body it is queried in its local coordinates.
+// Returns true if the shape collided with any non sensor shape.
+func (space *Space) ShapeQuery(shape *Shape, fnc SpaceShapeQueryFunc) (anyCollision bool) {
+	space.lock()
+	defer space.unlock(true)
+
+	if shape.Body != nil {
+		shape.Update()
+	} else {
+		shape.BB = shape.ShapeClass.update(transform.NewTransform(vect.Vector_Zero, 0))
+	}
+
+	shapeQuery := func(_, b Indexable) {
+		other := b.Shape()
+		if shape == other || (shape.Body != nil && shape.Body == other.Body) || (shape.Group != 0 && shape.Group == other.Group) ||
+			(shape.Layer&other.Layer) == 0 || (other.Body != nil && !other.Body.Enabled) {
+			return
+		}
+
+		contacts := space.pullContactBuffer()
+		defer space.pushContactBuffer(contacts)
+
+		numContacts := collide(contacts, shape, other)
+		if numContacts <= 0 {
+			return
+		}
+
+		if !(shape.IsSensor || other.IsSensor) {
+			anyCollision = true
+		}
+
+		if fnc != nil {
+			set := newContactPointSet(contacts[:numContacts])
+			fnc(other, &set)
+		}
+	}
+
+	space.staticShapes.Query(nil, shape.BB, shapeQuery)
+	space.activeShapes.Query(nil, shape.BB, shapeQuery)
+
+	return
+}
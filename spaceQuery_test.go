@@ -0,0 +1,351 @@
+package chipmunk
+
+import (
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// A row of dynamic circles of radius 1 at x = 10, 20, ..., 100 and a static 2x2 box at x = 55.
+// Returns the circles followed by the box.
+func queryScene(useIndex func(space *Space)) (*Space, []*Shape) {
+	space := NewSpace()
+	useIndex(space)
+
+	var shapes []*Shape
+	for i := 1; i <= 10; i++ {
+		body := NewBody(1, 1)
+		body.SetPosition(vect.Vect{vect.Float(i * 10), 0})
+		body.AddShape(NewCircle(vect.Vector_Zero, 1))
+		space.AddBody(body)
+		shapes = append(shapes, body.Shapes[0])
+	}
+
+	wall := NewBodyStatic()
+	wall.SetPosition(vect.Vect{55, 0})
+	wall.AddShape(NewBox(vect.Vector_Zero, 2, 2))
+	space.AddBody(wall)
+	shapes = append(shapes, wall.Shapes[0])
+
+	return space, shapes
+}
+
+// Adds a dynamic circle of radius 1 at pos for checking the query filters.
+func addFilterCircle(space *Space, pos vect.Vect) *Shape {
+	body := NewBody(1, 1)
+	body.SetPosition(pos)
+	body.AddShape(NewCircle(vect.Vector_Zero, 1))
+	space.AddBody(body)
+	return body.Shapes[0]
+}
+
+var queryIndexes = []struct {
+	name string
+	use  func(space *Space)
+}{
+	{"BBTree", useBBTree},
+	{"SpaceHash", useSpatialHash},
+	{"Sweep1D", useSweep1D},
+}
+
+func TestSegmentQuery(t *testing.T) {
+	for _, index := range queryIndexes {
+		space, shapes := queryScene(index.use)
+		box := shapes[10]
+
+		// Every shape on the segment is reported once with its own t.
+		hits := make(map[*Shape]vect.Float)
+		space.SegmentQuery(vect.Vect{0, 0}, vect.Vect{200, 0}, -1, 0, false, func(shape *Shape, hit vect.Float, n vect.Vect) {
+			if _, ok := hits[shape]; ok {
+				t.Errorf("%s: shape reported twice", index.name)
+			}
+			if !nearlyEqualVect(n, vect.Vect{-1, 0}) {
+				t.Errorf("%s: normal is %v, want {-1 0}", index.name, n)
+			}
+			hits[shape] = hit
+		})
+		if len(hits) != len(shapes) {
+			t.Errorf("%s: %d shapes hit, want %d", index.name, len(hits), len(shapes))
+		}
+		for i, shape := range shapes[:10] {
+			if want := vect.Float(i*10+9) / 200; !nearlyEqual(hits[shape], want) {
+				t.Errorf("%s: circle %d hit at %v, want %v", index.name, i, hits[shape], want)
+			}
+		}
+		if !nearlyEqual(hits[box], 54.0/200) {
+			t.Errorf("%s: box hit at %v, want %v", index.name, hits[box], 54.0/200)
+		}
+
+		// The first hit is the closest one to the start, whichever index the shape is in.
+		firstCases := []struct {
+			a, b  vect.Vect
+			shape *Shape
+			t     vect.Float
+		}{
+			{vect.Vect{0, 0}, vect.Vect{200, 0}, shapes[0], 9.0 / 200},
+			{vect.Vect{200, 0}, vect.Vect{0, 0}, shapes[9], 99.0 / 200},
+			{vect.Vect{50, 0}, vect.Vect{200, 0}, box, 4.0 / 150},
+			{vect.Vect{57, 0}, vect.Vect{200, 0}, shapes[5], 2.0 / 143},
+			{vect.Vect{53, 0}, vect.Vect{0, 0}, shapes[4], 2.0 / 53},
+			{vect.Vect{0, 5}, vect.Vect{200, 5}, nil, 1},
+		}
+		for _, c := range firstCases {
+			info := space.SegmentQueryFirst(c.a, c.b, -1, 0, false)
+			if info.Shape != c.shape || !nearlyEqual(info.T, c.t) {
+				t.Errorf("%s: first hit from %v to %v is shape %v at %v, want %v at %v",
+					index.name, c.a, c.b, info.Shape != nil, info.T, c.shape != nil, c.t)
+			}
+		}
+	}
+}
+
+func TestSegmentQueryFilter(t *testing.T) {
+	space, shapes := queryScene(useBBTree)
+	sensor := addFilterCircle(space, vect.Vect{5, 0})
+	sensor.IsSensor = true
+	grouped := addFilterCircle(space, vect.Vect{3, 0})
+	grouped.Group = 1
+	layered := addFilterCircle(space, vect.Vect{2, 0})
+	layered.Layer = 2
+
+	first := func(layers Layer, group Group, checkSensors bool) *Shape {
+		return space.SegmentQueryFirst(vect.Vect{0, 0}, vect.Vect{200, 0}, layers, group, checkSensors).Shape
+	}
+	if shape := first(1, 1, false); shape != shapes[0] {
+		t.Errorf("filtered query did not skip the sensor, group and layer")
+	}
+	if shape := first(1, 1, true); shape != sensor {
+		t.Errorf("query checking sensors did not hit the sensor")
+	}
+	if shape := first(1, 0, false); shape != grouped {
+		t.Errorf("query without a group did not hit the grouped shape")
+	}
+	if shape := first(2, 1, false); shape != layered {
+		t.Errorf("query in layer 2 did not hit the shape in layer 2")
+	}
+
+	count := 0
+	space.SegmentQuery(vect.Vect{0, 0}, vect.Vect{200, 0}, 1, 1, false, func(shape *Shape, hit vect.Float, n vect.Vect) {
+		count++
+	})
+	if count != len(shapes) {
+		t.Errorf("filtered query hit %d shapes, want %d", count, len(shapes))
+	}
+}
+
+// Segment queries of the indexes skip the shapes behind the t returned by the callback.
+func TestSegmentQueryExit(t *testing.T) {
+	for _, index := range queryIndexes[:2] {
+		var shapes []*Shape
+		for i := 0; i < 100; i++ {
+			body := NewBody(1, 1)
+			body.SetPosition(vect.Vect{vect.Float(i * 10), 0})
+			shape := NewCircle(vect.Vector_Zero, 1)
+			body.AddShape(shape)
+			shape.Update()
+			shapes = append(shapes, shape)
+		}
+		_, activeIndex := newTestIndexes(index.use, nil, shapes)
+
+		calls := 0
+		a, b := vect.Vect{-5, 0}, vect.Vect{1000, 0}
+		first := vect.Float(1)
+		activeIndex.SegmentQuery(nil, a, b, 1, func(_, obj Indexable) vect.Float {
+			calls++
+			info := SegmentQueryInfo{}
+			if obj.Shape().SegmentQuery(a, b, &info) {
+				first = vect.FMin(first, info.T)
+				return info.T
+			}
+			return 1
+		})
+		if !nearlyEqual(first, 4.0/1005) {
+			t.Errorf("%s: first hit at %v, want %v", index.name, first, 4.0/1005)
+		}
+		if calls > 5 {
+			t.Errorf("%s: %d shapes checked after the first hit, want the rest skipped", index.name, calls)
+		}
+	}
+}
+
+func TestPointQuery(t *testing.T) {
+	for _, index := range queryIndexes {
+		space, shapes := queryScene(index.use)
+		box := shapes[10]
+		sensor := addFilterCircle(space, vect.Vect{55.5, 0})
+		sensor.IsSensor = true
+
+		// Only the shapes containing the point are reported.
+		var found []*Shape
+		space.PointQuery(vect.Vect{55.5, 0.5}, -1, 0, false, func(shape *Shape, distance vect.Float, point vect.Vect) {
+			found = append(found, shape)
+			if !nearlyEqual(distance, -0.5) {
+				t.Errorf("%s: point is %v inside the box, want 0.5", index.name, -distance)
+			}
+		})
+		if len(found) != 1 || found[0] != box {
+			t.Errorf("%s: point query found %d shapes, want the box", index.name, len(found))
+		}
+
+		count := 0
+		space.PointQuery(vect.Vect{55.5, 0.5}, -1, 0, true, func(shape *Shape, distance vect.Float, point vect.Vect) {
+			count++
+		})
+		if count != 2 {
+			t.Errorf("%s: point query checking sensors found %d shapes, want 2", index.name, count)
+		}
+
+		if shape := space.SpacePointQueryFirst(vect.Vect{21, 0}, -1, 0, false); shape != shapes[1] {
+			t.Errorf("%s: point on the edge of a circle not found", index.name)
+		}
+		if shape := space.SpacePointQueryFirst(vect.Vect{25, 0}, -1, 0, false); shape != nil {
+			t.Errorf("%s: point between the shapes found a shape", index.name)
+		}
+	}
+}
+
+func TestNearestPointQuery(t *testing.T) {
+	for _, index := range queryIndexes {
+		space, shapes := queryScene(index.use)
+		box := shapes[10]
+
+		// The circles at 20 and 30 are 4 away from the point, only shapes closer than maxDistance are reported.
+		for _, c := range []struct {
+			maxDistance vect.Float
+			count       int
+		}{{5, 2}, {4, 0}, {3, 0}, {20, 4}} {
+			count := 0
+			space.NearestPointQuery(vect.Vect{25, 0}, c.maxDistance, -1, 0, false, func(shape *Shape, distance vect.Float, point vect.Vect) {
+				count++
+				if distance >= c.maxDistance {
+					t.Errorf("%s: shape at %v reported for a max distance of %v", index.name, distance, c.maxDistance)
+				}
+			})
+			if count != c.count {
+				t.Errorf("%s: %d shapes within %v, want %d", index.name, count, c.maxDistance, c.count)
+			}
+		}
+
+		info := space.NearestPointQueryNearest(vect.Vect{26, 0}, 10, -1, 0, false)
+		if info.Shape != shapes[2] || !nearlyEqual(info.Distance, 3) || !nearlyEqualVect(info.Point, vect.Vect{29, 0}) || !nearlyEqualVect(info.Gradient, vect.Vect{-1, 0}) {
+			t.Errorf("%s: nearest shape at %v with gradient %v, want the circle at 30, 3 away", index.name, info.Distance, info.Gradient)
+		}
+
+		// Points inside a shape have a negative distance, even for a max distance of 0.
+		info = space.NearestPointQueryNearest(vect.Vect{55.5, 0}, 0, -1, 0, false)
+		if info.Shape != box || !nearlyEqual(info.Distance, -0.5) || !nearlyEqualVect(info.Gradient, vect.Vect{1, 0}) {
+			t.Errorf("%s: nearest shape at %v with gradient %v, want the box at -0.5", index.name, info.Distance, info.Gradient)
+		}
+
+		info = space.NearestPointQueryNearest(vect.Vect{25, 0}, 4, -1, 0, false)
+		if info.Shape != nil || info.Distance != 4 {
+			t.Errorf("%s: nearest shape found beyond the max distance", index.name)
+		}
+
+		// The filters apply to nearest point queries too.
+		shapes[2].Layer = 2
+		info = space.NearestPointQueryNearest(vect.Vect{26, 0}, 10, 1, 0, false)
+		if info.Shape != shapes[1] || !nearlyEqual(info.Distance, 5) {
+			t.Errorf("%s: nearest shape in layer 1 at %v, want the circle at 20", index.name, info.Distance)
+		}
+	}
+}
+
+func TestBBQuery(t *testing.T) {
+	for _, index := range queryIndexes {
+		space, shapes := queryScene(index.use)
+		sensor := addFilterCircle(space, vect.Vect{35, 0})
+		sensor.IsSensor = true
+		grouped := addFilterCircle(space, vect.Vect{25, 0})
+		grouped.Group = 1
+		layered := addFilterCircle(space, vect.Vect{15, 0})
+		layered.Layer = 2
+
+		query := func(bb AABB, layers Layer, group Group, checkSensors bool) map[*Shape]bool {
+			found := make(map[*Shape]bool)
+			space.BBQuery(bb, layers, group, checkSensors, func(shape *Shape) {
+				if found[shape] {
+					t.Errorf("%s: shape reported twice", index.name)
+				}
+				found[shape] = true
+			})
+			return found
+		}
+
+		found := query(NewAABB(50, -5, 60, 5), -1, 0, false)
+		if len(found) != 3 || !found[shapes[4]] || !found[shapes[5]] || !found[shapes[10]] {
+			t.Errorf("%s: found %d shapes around the box, want the box and the circles next to it", index.name, len(found))
+		}
+
+		// Between the circles at 10 and 40 are the circles at 20 and 30 and the filtered ones.
+		bb := NewAABB(12, -5, 38, 5)
+		if found := query(bb, 1, 1, false); len(found) != 2 || !found[shapes[1]] || !found[shapes[2]] {
+			t.Errorf("%s: filtered query found %d shapes, want 2", index.name, len(found))
+		}
+		if found := query(bb, 1, 1, true); len(found) != 3 || !found[sensor] {
+			t.Errorf("%s: query checking sensors found %d shapes, want the sensor too", index.name, len(found))
+		}
+		if found := query(bb, 1, 0, false); len(found) != 3 || !found[grouped] {
+			t.Errorf("%s: query without a group found %d shapes, want the grouped shape too", index.name, len(found))
+		}
+		if found := query(bb, 3, 1, false); len(found) != 3 || !found[layered] {
+			t.Errorf("%s: query in layers 1 and 2 found %d shapes, want the shape in layer 2 too", index.name, len(found))
+		}
+	}
+}
+
+func TestShapeQuery(t *testing.T) {
+	for _, index := range queryIndexes {
+		space, shapes := queryScene(index.use)
+
+		// A shape without a body is queried where it is, the normals point towards the shapes found.
+		query := NewCircle(vect.Vect{25, 0}, 6)
+		found := make(map[*Shape]ContactPointSet)
+		collided := space.ShapeQuery(query, func(shape *Shape, points *ContactPointSet) {
+			found[shape] = *points
+		})
+		if !collided || len(found) != 2 {
+			t.Fatalf("%s: shape query found %d shapes, want 2", index.name, len(found))
+		}
+		for shape, normal := range map[*Shape]vect.Vect{shapes[1]: {-1, 0}, shapes[2]: {1, 0}} {
+			points := found[shape]
+			if points.Count != 1 || !nearlyEqualVect(points.Points[0].Normal, normal) || !nearlyEqual(points.Points[0].Dist, -2) {
+				t.Errorf("%s: contacts %+v, want one with normal %v 2 deep", index.name, points, normal)
+			}
+		}
+
+		// A shape on a body is queried at the position of the body.
+		body := NewBody(1, 1)
+		body.SetPosition(vect.Vect{55, 1.5})
+		onBody := NewBox(vect.Vector_Zero, 2, 2)
+		body.AddShape(onBody)
+		count := 0
+		if !space.ShapeQuery(onBody, func(shape *Shape, points *ContactPointSet) {
+			count++
+			if shape != shapes[10] {
+				t.Errorf("%s: box query hit a shape other than the box", index.name)
+			}
+		}) || count != 1 {
+			t.Errorf("%s: box query found %d shapes, want the static box", index.name, count)
+		}
+
+		// Sensors are reported but don't count as a collision.
+		sensor := addFilterCircle(space, vect.Vect{25, 5})
+		sensor.IsSensor = true
+		count = 0
+		query = NewCircle(vect.Vect{25, 10}, 5)
+		if space.ShapeQuery(query, func(shape *Shape, points *ContactPointSet) { count++ }) || count != 1 {
+			t.Errorf("%s: sensor query found %d shapes and a collision, want only the sensor", index.name, count)
+		}
+
+		// Shapes in the same group or other layers are skipped.
+		query = NewCircle(vect.Vect{25, 0}, 6)
+		shapes[1].Group = 1
+		shapes[2].Layer = 2
+		query.Group = 1
+		query.Layer = 1
+		if space.ShapeQuery(query, nil) {
+			t.Errorf("%s: query collided with filtered shapes", index.name)
+		}
+	}
+}
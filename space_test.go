@@ -0,0 +1,178 @@
+package chipmunk
+
+import (
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Steps the scene and returns the final body states and the bodies of the begin callbacks in call order.
+func runDropScene(steps int) ([]bodyState, [][2]int) {
+	space, bodies := dropScene()
+	for i, body := range bodies {
+		body.UserData = i
+	}
+
+	var begins [][2]int
+	handler := space.AddWildcardHandler(0)
+	handler.BeginFunc = func(arb *Arbiter, space *Space) bool {
+		a, b := arb.Bodies()
+		begins = append(begins, [2]int{bodyIndex(a), bodyIndex(b)})
+		return true
+	}
+
+	for i := 0; i < steps; i++ {
+		space.Step(1.0 / 60)
+	}
+	return bodyStates(bodies), begins
+}
+
+func bodyIndex(body *Body) int {
+	if i, ok := body.UserData.(int); ok {
+		return i
+	}
+	return -1
+}
+
+func TestStepDeterministic(t *testing.T) {
+	states, begins := runDropScene(240)
+	for k := 0; k < 3; k++ {
+		otherStates, otherBegins := runDropScene(240)
+		compareStates(t, "second run", otherStates, states)
+
+		if len(otherBegins) != len(begins) {
+			t.Fatalf("%d begin callbacks, want %d", len(otherBegins), len(begins))
+		}
+		for i := range begins {
+			if otherBegins[i] != begins[i] {
+				t.Fatalf("begin callback %d is between %v, want %v", i, otherBegins[i], begins[i])
+			}
+		}
+	}
+}
+
+// A space with gravity and a static floor along the x axis.
+func floorScene() (*Space, *Body) {
+	space := NewSpace()
+	space.Gravity = vect.Vect{0, -100}
+
+	floor := NewBodyStatic()
+	floor.AddShape(NewSegment(vect.Vect{-1000, 0}, vect.Vect{1000, 0}, 0))
+	space.AddBody(floor)
+	return space, floor
+}
+
+// Adds a box of the given size and mass 1 centered at pos.
+func addBox(space *Space, pos vect.Vect, size vect.Float) *Body {
+	shape := NewBox(vect.Vector_Zero, size, size)
+	body := NewBody(1, shape.Moment(1))
+	body.SetPosition(pos)
+	body.AddShape(shape)
+	space.AddBody(body)
+	return body
+}
+
+// Steps the space until the body falls asleep, failing after 10 seconds.
+func stepUntilSleeping(t *testing.T, space *Space, body *Body) {
+	for i := 0; i < 600; i++ {
+		space.Step(1.0 / 60)
+		if body.IsSleeping() {
+			return
+		}
+	}
+	t.Fatalf("body at %v never fell asleep", body.Position())
+}
+
+func containsBody(bodies []*Body, body *Body) bool {
+	for _, b := range bodies {
+		if b == body {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSleepIdleBody(t *testing.T) {
+	space, _ := floorScene()
+	space.SetSleepTimeThreshold(0.5)
+	box := addBox(space, vect.Vect{0, 5}, 10)
+	stepUntilSleeping(t, space, box)
+
+	if containsBody(space.Bodies, box) {
+		t.Errorf("sleeping body is still in the space bodies")
+	}
+	// The arbiters of the sleeping body are not solved, even in the step it fell asleep.
+	for _, arb := range space.Arbiters {
+		if arb.BodyA == box || arb.BodyB == box {
+			t.Errorf("arbiter of the sleeping body is solved")
+		}
+	}
+
+	pos := box.Position()
+	for i := 0; i < 60; i++ {
+		space.Step(1.0 / 60)
+	}
+	if !box.IsSleeping() || box.Position() != pos {
+		t.Errorf("sleeping body moved from %v to %v", pos, box.Position())
+	}
+}
+
+func TestSleepNeverWithoutThreshold(t *testing.T) {
+	space, _ := floorScene()
+	box := addBox(space, vect.Vect{0, 5}, 10)
+	for i := 0; i < 600; i++ {
+		space.Step(1.0 / 60)
+	}
+	if box.IsSleeping() {
+		t.Errorf("body fell asleep with sleeping disabled")
+	}
+}
+
+func TestWakeOnContact(t *testing.T) {
+	space, _ := floorScene()
+	space.SetSleepTimeThreshold(0.5)
+	box := addBox(space, vect.Vect{0, 5}, 10)
+	stepUntilSleeping(t, space, box)
+
+	falling := addBox(space, vect.Vect{0, 40}, 10)
+	woken := false
+	for i := 0; i < 60 && !woken; i++ {
+		space.Step(1.0 / 60)
+		woken = !box.IsSleeping()
+	}
+	if !woken {
+		t.Fatalf("sleeping body was not woken up by the body falling on it")
+	}
+	if falling.Position().Y < 10 {
+		t.Errorf("falling body went through the sleeping one, it is at %v", falling.Position())
+	}
+}
+
+func TestWakeOnChange(t *testing.T) {
+	changes := map[string]func(space *Space, box *Body){
+		"SetPosition": func(space *Space, box *Body) { box.SetPosition(vect.Vect{0, 20}) },
+		"SetVelocity": func(space *Space, box *Body) { box.SetVelocity(10, 0) },
+		"SetMass":     func(space *Space, box *Body) { box.SetMass(2) },
+		"AddConstraint": func(space *Space, box *Body) {
+			other := addBox(space, vect.Vect{20, 5}, 10)
+			space.AddConstraint(NewPinJoint(box, other, vect.Vector_Zero, vect.Vector_Zero))
+		},
+	}
+
+	for name, change := range changes {
+		space, _ := floorScene()
+		space.SetSleepTimeThreshold(0.5)
+		box := addBox(space, vect.Vect{0, 5}, 10)
+		stepUntilSleeping(t, space, box)
+
+		change(space, box)
+		if box.IsSleeping() || !containsBody(space.Bodies, box) {
+			t.Errorf("%s: body is still sleeping", name)
+		}
+
+		space.Step(1.0 / 60)
+		if box.IsSleeping() {
+			t.Errorf("%s: body fell asleep again right away", name)
+		}
+	}
+}
@@ -6,6 +6,10 @@ import (
 )
 
 type SpatialIndexQueryFunc func(a, b Indexable)
+
+// Called for each object whose bounds the segment crosses, returns the fraction
+// along the segment at which the object was hit, used to prune the rest of the query.
+type SpatialIndexSegmentQueryFunc func(obj, other Indexable) vect.Float
 type ReindexShapesFunc func(a, b *Shape, space *Space)
 type HashSetIterator func(node *Node)
 
@@ -17,7 +21,8 @@ type SpatialIndex struct {
 	staticIndex, dynamicIndex SpatialIndexClass
 }
 
-func SpatialIndexCollideStatic(dynamicIndex, staticIndex *SpatialIndex, fnc SpatialIndexQueryFunc) {
+// Reports the objects of the dynamic index overlapping objects of the static index.
+func SpatialIndexCollideStatic(dynamicIndex, staticIndex SpatialIndexClass, fnc SpatialIndexQueryFunc) {
 	if staticIndex.Count() > 0 {
 		dynamicIndex.Each(func(node *Node) {
 			staticIndex.Query(node.obj, node.obj.AABB(), fnc)
@@ -37,7 +42,7 @@ func NewSpartialIndex(class SpatialIndexClass, staticIndex *SpatialIndex) (index
 		if staticIndex.dynamicIndex != nil {
 			panic("This static index is already associated with a dynamic index.")
 		}
-		staticIndex.dynamicIndex = index
+		staticIndex.dynamicIndex = class
 	}
 
 	return
@@ -73,5 +78,5 @@ type SpatialIndexClass interface {
 	Stamp() time.Duration
 
 	Query(obj Indexable, aabb AABB, fnc SpatialIndexQueryFunc)
-	SegmentQuery(obj Indexable, a, b vect.Vect, t_exit vect.Float, fnc func())
+	SegmentQuery(obj Indexable, a, b vect.Vect, t_exit vect.Float, fnc SpatialIndexSegmentQueryFunc)
 }
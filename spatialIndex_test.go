@@ -0,0 +1,316 @@
+package chipmunk
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// A long floor with bodies spread along it moving sideways, like a side scroller.
+func sideScrollerScene() *Space {
+	space := NewSpace()
+	space.Gravity = vect.Vect{0, -900}
+
+	floor := NewBodyStatic()
+	for x := vect.Float(-4000); x < 4000; x += 100 {
+		floor.AddShape(NewSegment(vect.Vect{x, 0}, vect.Vect{x + 100, 0}, 1))
+	}
+	space.AddBody(floor)
+
+	for i := 0; i < 500; i++ {
+		shape := NewCircle(vect.Vector_Zero, 5)
+		if i%2 == 1 {
+			shape = NewBox(vect.Vector_Zero, 10, 10)
+		}
+		body := NewBody(1, shape.Moment(1))
+		body.SetPosition(vect.Vect{vect.Float(i)*15 - 3750, vect.Float(10 + (i%4)*12)})
+		body.SetVelocity(vect.Float(i%7-3)*20, 0)
+		body.AddShape(shape)
+		space.AddBody(body)
+	}
+
+	return space
+}
+
+// Bodies piled up in a box.
+func pileScene() *Space {
+	space := NewSpace()
+	space.Gravity = vect.Vect{0, -900}
+
+	walls := NewBodyStatic()
+	walls.AddShape(NewSegment(vect.Vect{-200, 0}, vect.Vect{200, 0}, 1))
+	walls.AddShape(NewSegment(vect.Vect{-200, 0}, vect.Vect{-200, 1000}, 1))
+	walls.AddShape(NewSegment(vect.Vect{200, 0}, vect.Vect{200, 1000}, 1))
+	space.AddBody(walls)
+
+	for i := 0; i < 500; i++ {
+		shape := NewCircle(vect.Vector_Zero, 5)
+		if i%2 == 1 {
+			shape = NewBox(vect.Vector_Zero, 10, 10)
+		}
+		body := NewBody(1, shape.Moment(1))
+		body.SetPosition(vect.Vect{vect.Float(i%30)*12 - 180, vect.Float(10 + (i/30)*12)})
+		body.AddShape(shape)
+		space.AddBody(body)
+	}
+
+	return space
+}
+
+func benchmarkStep(b *testing.B, scene func() *Space, useIndex func(space *Space)) {
+	space := scene()
+	useIndex(space)
+
+	for i := 0; i < 60; i++ {
+		space.Step(1.0 / 60)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		space.Step(1.0 / 60)
+	}
+}
+
+func useBBTree(space *Space) {}
+
+func useSpatialHash(space *Space) {
+	space.UseSpatialHash(10, 5000)
+}
+
+func useSweep1D(space *Space) {
+	space.UseSweep1D()
+}
+
+func BenchmarkSideScrollerBBTree(b *testing.B) {
+	benchmarkStep(b, sideScrollerScene, useBBTree)
+}
+
+func BenchmarkSideScrollerSpaceHash(b *testing.B) {
+	benchmarkStep(b, sideScrollerScene, useSpatialHash)
+}
+
+func BenchmarkSideScrollerSweep1D(b *testing.B) {
+	benchmarkStep(b, sideScrollerScene, useSweep1D)
+}
+
+func BenchmarkPileBBTree(b *testing.B) {
+	benchmarkStep(b, pileScene, useBBTree)
+}
+
+func BenchmarkPileSpaceHash(b *testing.B) {
+	benchmarkStep(b, pileScene, useSpatialHash)
+}
+
+func BenchmarkPileSweep1D(b *testing.B) {
+	benchmarkStep(b, pileScene, useSweep1D)
+}
+
+// Pairs of shape hashes, the smaller hash first. Single shapes use 0 as the second hash.
+type hashSet map[[2]HashValue]bool
+
+func pairKey(a, b Indexable) [2]HashValue {
+	if a.Hash() > b.Hash() {
+		a, b = b, a
+	}
+	return [2]HashValue{a.Hash(), b.Hash()}
+}
+
+// Static segments and moving circles and boxes, each on its own body, spread over a 400x400 area.
+func indexTestShapes() (static, active []*Shape) {
+	r := rand.New(rand.NewSource(1))
+	random := func(min, max float64) vect.Float {
+		return vect.Float(min + r.Float64()*(max-min))
+	}
+
+	for i := 0; i < 40; i++ {
+		a := vect.Vect{random(-200, 200), random(-200, 200)}
+		b := vect.Add(a, vect.Vect{random(-30, 30), random(-30, 30)})
+		body := NewBodyStatic()
+		shape := NewSegment(a, b, random(0, 2))
+		body.AddShape(shape)
+		shape.Update()
+		static = append(static, shape)
+	}
+
+	for i := 0; i < 200; i++ {
+		shape := NewCircle(vect.Vector_Zero, random(1, 6))
+		if i%2 == 1 {
+			shape = NewBox(vect.Vector_Zero, random(2, 12), random(2, 12))
+		}
+		body := NewBody(1, 1)
+		body.AddShape(shape)
+		body.SetPosition(vect.Vect{random(-200, 200), random(-200, 200)})
+		body.SetAngle(random(0, 3))
+		body.SetVelocity(random(-100, 100), random(-100, 100))
+		shape.Update()
+		active = append(active, shape)
+	}
+
+	return static, active
+}
+
+// Indexes like the ones of a space using the given index for its active shapes.
+func newTestIndexes(useIndex func(space *Space), static, active []*Shape) (staticIndex, activeIndex *SpatialIndex) {
+	space := NewSpace()
+	useIndex(space)
+	staticIndex, activeIndex = space.staticShapes, space.activeShapes
+	for _, shape := range static {
+		staticIndex.Insert(shape)
+	}
+	for _, shape := range active {
+		activeIndex.Insert(shape)
+	}
+	return staticIndex, activeIndex
+}
+
+// Returns the pairs of overlapping shapes found by ReindexQuery, dropping the candidates whose boxes don't overlap.
+func indexPairs(activeIndex *SpatialIndex) hashSet {
+	pairs := make(hashSet)
+	activeIndex.ReindexQuery(func(a, b Indexable) {
+		if TestOverlap(a.AABB(), b.AABB()) {
+			pairs[pairKey(a, b)] = true
+		}
+	})
+	return pairs
+}
+
+func bruteForcePairs(static, active []*Shape) hashSet {
+	pairs := make(hashSet)
+	for i, a := range active {
+		for _, b := range active[i+1:] {
+			if TestOverlap(a.BB, b.BB) {
+				pairs[pairKey(a, b)] = true
+			}
+		}
+		for _, b := range static {
+			if TestOverlap(a.BB, b.BB) {
+				pairs[pairKey(a, b)] = true
+			}
+		}
+	}
+	return pairs
+}
+
+// Returns the shapes of both indexes whose boxes overlap bb.
+func indexQuery(staticIndex, activeIndex *SpatialIndex, bb AABB) hashSet {
+	shapes := make(hashSet)
+	query := func(_, obj Indexable) {
+		if TestOverlap(obj.AABB(), bb) {
+			shapes[[2]HashValue{obj.Hash()}] = true
+		}
+	}
+	staticIndex.Query(nil, bb, query)
+	activeIndex.Query(nil, bb, query)
+	return shapes
+}
+
+// Returns the shapes of both indexes whose boxes the segment from a to b crosses.
+func indexSegmentQuery(staticIndex, activeIndex *SpatialIndex, a, b vect.Vect) hashSet {
+	shapes := make(hashSet)
+	query := func(_, obj Indexable) vect.Float {
+		bb := obj.AABB()
+		if bb.SegmentQuery(a, b) <= 1 {
+			shapes[[2]HashValue{obj.Hash()}] = true
+		}
+		return 1
+	}
+	staticIndex.SegmentQuery(nil, a, b, 1, query)
+	activeIndex.SegmentQuery(nil, a, b, 1, query)
+	return shapes
+}
+
+func bruteForceQuery(shapes []*Shape, match func(bb AABB) bool) hashSet {
+	found := make(hashSet)
+	for _, shape := range shapes {
+		if match(shape.BB) {
+			found[[2]HashValue{shape.Hash()}] = true
+		}
+	}
+	return found
+}
+
+func compareHashSets(t *testing.T, name string, got, want hashSet) {
+	missing, extra := 0, 0
+	for key := range want {
+		if !got[key] {
+			missing++
+		}
+	}
+	for key := range got {
+		if !want[key] {
+			extra++
+		}
+	}
+	if missing != 0 || extra != 0 {
+		t.Errorf("%s: %d results missing and %d extra out of %d", name, missing, extra, len(want))
+	}
+}
+
+// Checks the pairs and queries of the index against a BBTree holding the same shapes and against a brute force search.
+func checkIndex(t *testing.T, useIndex func(space *Space)) {
+	static, active := indexTestShapes()
+	staticIndex, activeIndex := newTestIndexes(useIndex, static, active)
+	staticTree, activeTree := newTestIndexes(useBBTree, static, active)
+
+	check := func(stage string, static, active []*Shape) {
+		all := append(append([]*Shape(nil), static...), active...)
+
+		want := bruteForcePairs(static, active)
+		compareHashSets(t, stage+" BBTree pairs", indexPairs(activeTree), want)
+		compareHashSets(t, stage+" pairs", indexPairs(activeIndex), want)
+
+		for _, bb := range []AABB{NewAABB(-50, -50, 50, 50), NewAABB(-210, 100, 210, 110), NewAABB(150, -150, 151, 151)} {
+			want := bruteForceQuery(all, func(other AABB) bool { return TestOverlap(other, bb) })
+			compareHashSets(t, stage+" BBTree Query", indexQuery(staticTree, activeTree, bb), want)
+			compareHashSets(t, stage+" Query", indexQuery(staticIndex, activeIndex, bb), want)
+		}
+
+		for _, seg := range [][2]vect.Vect{{{-200, -190}, {190, 200}}, {{150, -200}, {-170, 30}}, {{-5, 200}, {3, -200}}} {
+			a, b := seg[0], seg[1]
+			want := bruteForceQuery(all, func(bb AABB) bool { return bb.SegmentQuery(a, b) <= 1 })
+			compareHashSets(t, stage+" BBTree SegmentQuery", indexSegmentQuery(staticTree, activeTree, a, b), want)
+			compareHashSets(t, stage+" SegmentQuery", indexSegmentQuery(staticIndex, activeIndex, a, b), want)
+		}
+	}
+
+	check("inserted", static, active)
+
+	// Removed shapes must not be reported, even by the handles a spatial hash keeps in its cells.
+	var kept, removed []*Shape
+	for i, shape := range active {
+		if i%3 == 0 {
+			activeIndex.Remove(shape)
+			activeTree.Remove(shape)
+			removed = append(removed, shape)
+		} else {
+			kept = append(kept, shape)
+		}
+	}
+	active = kept
+	check("removed", static, active)
+
+	for step := 0; step < 5; step++ {
+		for _, shape := range active {
+			body := shape.Body
+			body.p = vect.Add(body.p, vect.Mult(body.v, 1.0/60))
+			shape.Update()
+		}
+		check("moved", static, active)
+	}
+
+	for _, shape := range removed[:len(removed)/2] {
+		activeIndex.Insert(shape)
+		activeTree.Insert(shape)
+		active = append(active, shape)
+	}
+	check("inserted again", static, active)
+}
+
+func TestSpaceHashMatchesBBTree(t *testing.T) {
+	checkIndex(t, useSpatialHash)
+}
+
+func TestSweep1DMatchesBBTree(t *testing.T) {
+	checkIndex(t, useSweep1D)
+}
@@ -0,0 +1,157 @@
+package chipmunk
+
+import (
+	"time"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Sort and sweep spatial index based on cpSweep1D.
+// The objects are kept sorted along the x axis, the table is sorted again each ReindexQuery with an insertion sort
+// which is fast as long as the order changes little between steps. Works best for worlds spread along the x axis.
+// Queries test every object, so it is better suited for the active shapes than for the static ones.
+type Sweep1D struct {
+	SpatialIndexClass
+	SpatialIndex *SpatialIndex
+
+	// The objects sorted by the left side of their bounding boxes.
+	table []*Node
+	cells HashSet
+
+	// Number of pairs found by the last ReindexQuery.
+	pairs int
+}
+
+func NewSweep1D(staticIndex *SpatialIndex) *SpatialIndex {
+	sweep := &Sweep1D{}
+	sweep.cells = make(HashSet)
+
+	sweep.SpatialIndex = NewSpartialIndex(sweep, staticIndex)
+	return sweep.SpatialIndex
+}
+
+func (sweep *Sweep1D) Destroy() {
+	sweep.table = nil
+	sweep.cells = nil
+}
+
+func (sweep *Sweep1D) Count() int {
+	return len(sweep.table)
+}
+
+func (sweep *Sweep1D) Each(fnc HashSetIterator) {
+	for _, cell := range sweep.table {
+		fnc(cell)
+	}
+}
+
+func (sweep *Sweep1D) Contains(obj Indexable) bool {
+	return sweep.cells[obj.Hash()] != nil
+}
+
+func (sweep *Sweep1D) Stamp() time.Duration {
+	return 0
+}
+
+// Returns the number of pairs of overlapping objects found by the last ReindexQuery.
+func (sweep *Sweep1D) Pairs() int {
+	return sweep.pairs
+}
+
+// Adds the object at the end of the table, the table is sorted again by the next Reindex or ReindexQuery.
+// The queries don't depend on the order.
+func (sweep *Sweep1D) Insert(obj Indexable) {
+	cell := &Node{obj: obj, bb: obj.AABB()}
+	sweep.cells[obj.Hash()] = cell
+	cell.index = len(sweep.table)
+	sweep.table = append(sweep.table, cell)
+}
+
+// Removes the object by moving the last object of the table to its place, the table is sorted again by the next
+// Reindex or ReindexQuery. The queries don't depend on the order.
+func (sweep *Sweep1D) Remove(obj Indexable) {
+	cell := sweep.cells[obj.Hash()]
+	if cell == nil {
+		return
+	}
+	delete(sweep.cells, obj.Hash())
+
+	last := len(sweep.table) - 1
+	moved := sweep.table[last]
+	sweep.table[cell.index], moved.index = moved, cell.index
+	sweep.table[last] = nil
+	sweep.table = sweep.table[:last]
+}
+
+func (sweep *Sweep1D) Reindex() {
+	for _, cell := range sweep.table {
+		cell.bb = cell.obj.AABB()
+	}
+	sweep.sort()
+}
+
+func (sweep *Sweep1D) ReindexObject(obj Indexable) {
+	if cell := sweep.cells[obj.Hash()]; cell != nil {
+		cell.bb = obj.AABB()
+	}
+}
+
+func (sweep *Sweep1D) ReindexQuery(fnc SpatialIndexQueryFunc) {
+	sweep.pairs = 0
+	countFnc := fnc
+	fnc = func(a, b Indexable) {
+		sweep.pairs++
+		countFnc(a, b)
+	}
+
+	sweep.Reindex()
+
+	table := sweep.table
+	for i, cell := range table {
+		max := cell.bb.Upper.X
+		for j := i + 1; j < len(table) && table[j].bb.Lower.X <= max; j++ {
+			if TestOverlapPtr(&cell.bb, &table[j].bb) {
+				fnc(cell.obj, table[j].obj)
+			}
+		}
+	}
+
+	// Reindex query is also responsible for colliding against the static index.
+	if staticIndex := sweep.SpatialIndex.staticIndex; staticIndex != nil {
+		SpatialIndexCollideStatic(sweep, staticIndex, fnc)
+	}
+}
+
+// Sorts the table by the left side of the bounding boxes.
+// Insertion sort, the table is almost sorted already and equal objects keep their order.
+func (sweep *Sweep1D) sort() {
+	table := sweep.table
+	for i := 1; i < len(table); i++ {
+		cell := table[i]
+		j := i
+		for ; j > 0 && table[j-1].bb.Lower.X > cell.bb.Lower.X; j-- {
+			table[j] = table[j-1]
+			table[j].index = j
+		}
+		table[j] = cell
+		cell.index = j
+	}
+}
+
+func (sweep *Sweep1D) Query(obj Indexable, aabb AABB, fnc SpatialIndexQueryFunc) {
+	for _, cell := range sweep.table {
+		if TestOverlapPtr(&aabb, &cell.bb) && obj != cell.obj {
+			fnc(obj, cell.obj)
+		}
+	}
+}
+
+func (sweep *Sweep1D) SegmentQuery(obj Indexable, a, b vect.Vect, t_exit vect.Float, fnc SpatialIndexSegmentQueryFunc) {
+	aabb := Expand(NewAABB(a.X, a.Y, a.X, a.Y), b)
+
+	for _, cell := range sweep.table {
+		if TestOverlapPtr(&aabb, &cell.bb) && cell.bb.SegmentQuery(a, b) < t_exit {
+			t_exit = vect.FMin(t_exit, fnc(obj, cell.obj))
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !float64
+
+package vect
+
+// Float is the floating point type used by the engine.
+// Build with the float64 tag to use double precision.
+type Float float32
+
+// Size of Float in bits.
+const floatBits = 32
@@ -0,0 +1,10 @@
+//go:build float64
+
+package vect
+
+// Float is the floating point type used by the engine.
+// Built with the float64 tag, double precision.
+type Float float64
+
+// Size of Float in bits.
+const floatBits = 64
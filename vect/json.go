@@ -1,10 +1,55 @@
-package vect 
+package vect
 
 import (
 	"encoding/json"
 	"log"
+	"math"
+	"strconv"
 )
 
+// Marshals the float as a JSON number, infinities and NaN are written as the strings "+Inf", "-Inf" and "NaN".
+func (f Float) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	}
+
+	// Same formatting as encoding/json.
+	format := byte('f')
+	if abs := math.Abs(v); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	return strconv.AppendFloat(nil, v, format, -1, floatBits), nil
+}
+
+func (f *Float) UnmarshalJSON(data []byte) error {
+	var v float64
+
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		//try string form
+		var s string
+		if json.Unmarshal(data, &s) != nil {
+			log.Printf("Error decoding Float")
+			return err
+		}
+
+		v, err = strconv.ParseFloat(s, 64)
+		if err != nil {
+			log.Printf("Error decoding Float")
+			return err
+		}
+	}
+
+	*f = Float(v)
+	return nil
+}
+
 func (v Vect) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&[2]Float{v.X, v.Y})
 }
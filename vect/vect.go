@@ -4,8 +4,6 @@ import (
 	"math"
 )
 
-type Float float32
-
 var (
 	Vector_Zero = Vect{0, 0}
 )
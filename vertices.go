@@ -1,6 +1,6 @@
 package chipmunk
 
-import ( 
+import (
 	"github.com/vova616/chipmunk/vect"
 )
 
@@ -23,3 +23,120 @@ func (verts Vertices) ValidatePolygon() bool {
 
 	return true
 }
+
+// Returns true if the vertices are winded clockwise, the winding used by the polygons.
+func (verts Vertices) IsClockwise() bool {
+	return AreaForPoly(verts) >= 0
+}
+
+// Returns a copy of the vertices in reverse order.
+func (verts Vertices) Reversed() Vertices {
+	reversed := make(Vertices, len(verts))
+	for i, v := range verts {
+		reversed[len(verts)-1-i] = v
+	}
+	return reversed
+}
+
+// Returns the convex hull of the vertices winded clockwise, starting at the vertex with the smallest x.
+// Vertices within tolerance of the edges of the hull are dropped, with a tolerance of 0 a few collinear vertices may remain.
+// Uses the quickhull algorithm like cpConvexHull.
+func (verts Vertices) ConvexHull(tolerance vect.Float) Vertices {
+	hull := make(Vertices, len(verts))
+	copy(hull, verts)
+	if len(hull) == 0 {
+		return hull
+	}
+
+	start, end := hull.loopIndexes()
+	if start == end {
+		// All the vertices are the same point.
+		return hull[:1]
+	}
+
+	hull[0], hull[start] = hull[start], hull[0]
+	if end == 0 {
+		end = start
+	}
+	hull[1], hull[end] = hull[end], hull[1]
+
+	a, b := hull[0], hull[1]
+	count := qHullReduce(tolerance, hull[2:], a, b, a, hull[1:]) + 1
+	return hull[:count]
+}
+
+// Returns the indexes of the vertices with the smallest and largest x.
+func (verts Vertices) loopIndexes() (start, end int) {
+	min, max := verts[0], verts[0]
+	for i := 1; i < len(verts); i++ {
+		v := verts[i]
+		if v.X < min.X || (v.X == min.X && v.Y < min.Y) {
+			min = v
+			start = i
+		} else if v.X > max.X || (v.X == max.X && v.Y > max.Y) {
+			max = v
+			end = i
+		}
+	}
+	return
+}
+
+// Moves the vertices left of the line from a to b to the front of verts and returns their count.
+// The vertex farthest from the line is moved first.
+func qHullPartition(verts Vertices, a, b vect.Vect, tolerance vect.Float) int {
+	if len(verts) == 0 {
+		return 0
+	}
+
+	max := vect.Float(0)
+	pivot := 0
+
+	delta := vect.Sub(b, a)
+	valueTolerance := tolerance * vect.Length(delta)
+
+	head := 0
+	for tail := len(verts) - 1; head <= tail; {
+		value := vect.Cross(delta, vect.Sub(verts[head], a))
+		if value > valueTolerance {
+			if value > max {
+				max = value
+				pivot = head
+			}
+			head++
+		} else {
+			verts[head], verts[tail] = verts[tail], verts[head]
+			tail--
+		}
+	}
+
+	// Move the new pivot to the front if it's not already there.
+	if pivot != 0 {
+		verts[0], verts[pivot] = verts[pivot], verts[0]
+	}
+	return head
+}
+
+// Writes the hull of the vertices left of the lines from a to pivot and from pivot to b into result,
+// ending with pivot, and returns the number of vertices written. result may overlap the front of verts.
+func qHullReduce(tolerance vect.Float, verts Vertices, a, pivot, b vect.Vect, result Vertices) int {
+	if len(verts) == 0 {
+		result[0] = pivot
+		return 1
+	}
+
+	index := 0
+	leftCount := qHullPartition(verts, a, pivot, tolerance)
+	if leftCount > 0 {
+		index = qHullReduce(tolerance, verts[1:leftCount], a, verts[0], pivot, result)
+	}
+
+	result[index] = pivot
+	index++
+
+	right := verts[leftCount:]
+	rightCount := qHullPartition(right, pivot, b, tolerance)
+	if rightCount > 0 {
+		index += qHullReduce(tolerance, right[1:rightCount], pivot, right[0], b, result[index:])
+	}
+	return index
+}
@@ -0,0 +1,91 @@
+package chipmunk
+
+import (
+	"sync"
+)
+
+// Part of a job run by a worker.
+type workerJob struct {
+	fnc  func(part int)
+	part int
+}
+
+// Goroutines running the parts of the jobs sent to them, used by the solver and the collision detection.
+type workerPool struct {
+	jobs chan workerJob
+	wg   sync.WaitGroup
+}
+
+func newWorkerPool(workers int) *workerPool {
+	pool := &workerPool{jobs: make(chan workerJob)}
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+func (pool *workerPool) work() {
+	for job := range pool.jobs {
+		job.fnc(job.part)
+		pool.wg.Done()
+	}
+}
+
+// Calls fnc for each part from 0 to parts-1 and waits for all of them to return.
+// The last part is run by the calling goroutine.
+func (pool *workerPool) run(parts int, fnc func(part int)) {
+	pool.wg.Add(parts - 1)
+	for i := 0; i < parts-1; i++ {
+		pool.jobs <- workerJob{fnc, i}
+	}
+	fnc(parts - 1)
+	pool.wg.Wait()
+}
+
+func (pool *workerPool) stop() {
+	close(pool.jobs)
+}
+
+// Returns the number of parts to split count items into so every worker gets at least minPart of them.
+func (space *Space) workerParts(count, minPart int) int {
+	parts := count / minPart
+	if parts > space.workers {
+		parts = space.workers
+	}
+	if parts < 1 {
+		parts = 1
+	}
+	return parts
+}
+
+// Sets the number of goroutines stepping the space, the goroutine calling Step is one of them.
+// The default of 1 does everything serially. With more workers the narrow phase collision detection and the solver
+// of large scenes run in parallel.
+// The collisions are merged in the order the broad phase found them, so the collision detection gives the same
+// results for any number of workers. The solver splits the arbiters and constraints into batches that don't share
+// a body and solves the batches in parallel. The batches only depend on the order of the arbiters and constraints,
+// so the results are the same for any number of workers above 1, but they differ from the serial results.
+// The goroutines are stopped by setting the workers back to 1 or by Destroy.
+func (space *Space) SetWorkers(workers int) {
+	space.assertUnlocked()
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	if space.workerPool != nil {
+		space.workerPool.stop()
+		space.workerPool = nil
+	}
+
+	space.workers = workers
+	space.collideWorkers = nil
+	if workers > 1 {
+		space.workerPool = newWorkerPool(workers - 1)
+		space.collideWorkers = make([]collideWorker, workers)
+	}
+}
+
+func (space *Space) Workers() int {
+	return space.workers
+}
@@ -0,0 +1,147 @@
+package chipmunk
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/vova616/chipmunk/vect"
+)
+
+// Steps the pile with the given number of workers, the pile is large enough to collide and solve in parallel.
+func runPileScene(workers, steps int) []bodyState {
+	return runScene(pileScene(), workers, steps)
+}
+
+func runScene(space *Space, workers, steps int) []bodyState {
+	bodies := append([]*Body(nil), space.Bodies...)
+
+	space.SetWorkers(workers)
+	defer space.Destroy()
+	for i := 0; i < steps; i++ {
+		space.Step(1.0 / 60)
+	}
+	return bodyStates(bodies)
+}
+
+func TestWorkersDeterministic(t *testing.T) {
+	serial := runPileScene(1, 60)
+	compareStates(t, "second serial run", runPileScene(1, 60), serial)
+
+	parallel := runPileScene(4, 60)
+	compareStates(t, "second run with 4 workers", runPileScene(4, 60), parallel)
+	compareStates(t, "run with 2 workers", runPileScene(2, 60), parallel)
+}
+
+// Run with -race to check that the batches never write a body another batch uses.
+func TestWorkersJointsAndKinematic(t *testing.T) {
+	parallel := runScene(jointPileScene(), 4, 60)
+	compareStates(t, "second run with 4 workers", runScene(jointPileScene(), 4, 60), parallel)
+	compareStates(t, "run with 2 workers", runScene(jointPileScene(), 2, 60), parallel)
+}
+
+// The pile with kinematic paddles pushing through it and joints between its bodies,
+// a static body and the paddles, so the solver batches share bodies of every type.
+func jointPileScene() *Space {
+	space := pileScene()
+	pile := append([]*Body(nil), space.Bodies...)
+	anchors := NewBodyStatic()
+	space.AddBody(anchors)
+
+	var paddles []*Body
+	for i := 0; i < 3; i++ {
+		paddle := NewBodyKinematic()
+		paddle.SetPosition(vect.Vect{vect.Float(i*120 - 120), 40})
+		paddle.SetVelocity(vect.Float(30-i*30), 5)
+		paddle.SetAngularVelocity(1)
+		paddle.AddShape(NewBox(vect.Vector_Zero, 40, 8))
+		space.AddBody(paddle)
+		paddles = append(paddles, paddle)
+	}
+
+	for i, body := range pile {
+		switch i % 5 {
+		case 0:
+			space.AddConstraint(NewPinJoint(body, pile[(i+1)%len(pile)], vect.Vector_Zero, vect.Vector_Zero))
+		case 1:
+			space.AddConstraint(NewSlideJoint(anchors, body, body.Position(), vect.Vector_Zero, 0, 20))
+		case 2:
+			space.AddConstraint(NewDampedRotarySpring(paddles[i%3], body, 0, 1000, 10))
+		case 3:
+			space.AddConstraint(NewGearJoint(body, pile[(i+7)%len(pile)], 0, 1))
+		}
+	}
+
+	return space
+}
+
+type arbiterRecord struct {
+	a, b     HashValue
+	contacts []Contact
+}
+
+// Steps the space once and returns its arbiters and the callbacks called during the step.
+func recordStep(space *Space, log *[]string) []arbiterRecord {
+	*log = (*log)[0:0]
+	space.Step(1.0 / 60)
+
+	arbiters := make([]arbiterRecord, len(space.Arbiters))
+	for i, arb := range space.Arbiters {
+		arbiters[i] = arbiterRecord{a: arb.ShapeA.Hash(), b: arb.ShapeB.Hash()}
+		for _, con := range arb.Contacts {
+			arbiters[i].contacts = append(arbiters[i].contacts, Contact{p: con.p, n: con.n, dist: con.dist, hash: con.hash})
+		}
+	}
+	return arbiters
+}
+
+// The narrow phase run on the workers finds the same arbiters and calls the callbacks in the same order as the serial one.
+func TestWorkersNarrowPhase(t *testing.T) {
+	space := pileScene()
+	defer space.Destroy()
+
+	var log []string
+	record := func(event string) func(arb *Arbiter) {
+		return func(arb *Arbiter) {
+			a, b := arb.Shapes()
+			log = append(log, fmt.Sprint(event, a.Hash(), b.Hash()))
+		}
+	}
+	handler := space.AddCollisionHandler(0, 0)
+	handler.BeginFunc = func(arb *Arbiter, space *Space) bool { record("begin")(arb); return true }
+	handler.PreSolveFunc = func(arb *Arbiter, space *Space) bool { record("preSolve")(arb); return true }
+	handler.PostSolveFunc = func(arb *Arbiter, space *Space) { record("postSolve")(arb) }
+	handler.SeparateFunc = func(arb *Arbiter, space *Space) { record("separate")(arb) }
+
+	for i := 0; i < 30; i++ {
+		space.Step(1.0 / 60)
+	}
+
+	// Each step is taken serially and on the workers from the same state, the solver
+	// results differ between the two so the serial one is kept for the next step.
+	for step := 0; step < 10; step++ {
+		snapshot := space.Snapshot()
+		space.SetWorkers(4)
+		parallel := recordStep(space, &log)
+		parallelLog := append([]string(nil), log...)
+
+		space.Restore(snapshot)
+		space.SetWorkers(1)
+		serial := recordStep(space, &log)
+
+		if len(serial) < collideMinParallel {
+			t.Fatalf("step %d: only %d arbiters, the narrow phase runs serially", step, len(serial))
+		}
+		if len(parallel) != len(serial) {
+			t.Fatalf("step %d: %d arbiters on the workers, want %d", step, len(parallel), len(serial))
+		}
+		for i := range serial {
+			if !reflect.DeepEqual(parallel[i], serial[i]) {
+				t.Fatalf("step %d: arbiter %d is %+v on the workers, want %+v", step, i, parallel[i], serial[i])
+			}
+		}
+		if !reflect.DeepEqual(parallelLog, log) {
+			t.Fatalf("step %d: callbacks on the workers differ from the serial ones", step)
+		}
+	}
+}